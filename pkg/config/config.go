@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/magiconair/properties"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type RunAs int64
@@ -134,18 +139,94 @@ type Config struct {
 	runAs RunAs
 	runIn RunIn
 
-	serverPort    int
-	logLevel      string
-	burst         int
-	contentType   ContentType
-	withResources bool
+	serverPort     int
+	logLevel       string
+	burst          int
+	contentType    ContentType
+	withResources  bool
+	containerRoles []string
+
+	timeout        time.Duration
+	requestTimeout time.Duration
+
+	kubeconfig string
+	context    string
+	namespace  string
+	as         string
+
+	versionStrategies []string
+	versionTagRegexp  *regexp.Regexp
+	versionEnvVars    []string
+	versionFallback   string
+
+	registryLookup      bool
+	registryCredentials string
+	registryCacheDir    string
+
+	imageCacheTTL    time.Duration
+	imageCacheTTLSet bool
+	imageCacheFile   string
+
+	verifyBuilds bool
+
+	staleImageAge time.Duration
+
+	customKindsFileName string
+	customKinds         []*CustomKind
 
 	runnerConfig *RunnerConfig
 }
 
+// The strategies to extract the image versions, also reported as the source of the versions
+const (
+	// TagVersionStrategy is the tag of the image reference, or the part of it matching the tag regular expression
+	TagVersionStrategy = "tag"
+	// OCILabelVersionStrategy is the org.opencontainers.image.version label of the image
+	OCILabelVersionStrategy = "oci-label"
+	// LabelVersionStrategy is the version label of the image, followed by the release label if any, like 7.9.1-3
+	LabelVersionStrategy = "label"
+	// EnvVersionStrategy is the first of the version environment variables, set in the pod template or in the image
+	EnvVersionStrategy = "env"
+)
+
+// DefaultVersionStrategies are the strategies to extract the image versions, tried in order, when none are configured.
+// The labels come first, as the tags are often mutable ones like latest, which are no version
+const DefaultVersionStrategies = OCILabelVersionStrategy + "," + LabelVersionStrategy + "," + TagVersionStrategy + "," + EnvVersionStrategy
+
+// DefaultVersionEnvVars are the environment variables holding the image version, when none are configured
+const DefaultVersionEnvVars = "JBOSS_IMAGE_VERSION"
+
+// DefaultVersionFallback is the image version reported when no strategy finds one, when none is configured
+const DefaultVersionFallback = "NA"
+
+var versionStrategyNames = []string{TagVersionStrategy, OCILabelVersionStrategy, LabelVersionStrategy, EnvVersionStrategy}
+
+// DefaultImageCacheTTL is the time the ImageStreamImages are reused by the following collections, like those of the
+// REST requests and of the Prometheus scrapes
+const DefaultImageCacheTTL = time.Hour
+
+// DefaultPersistentImageCacheTTL is the time the ImageStreamImages of the cache file are reused by the following
+// executions, when no time to live is configured. The Images are named after their immutable digest, so they are only
+// expired to forget the deleted ones
+const DefaultPersistentImageCacheTTL = 7 * 24 * time.Hour
+
+// DefaultStaleImageAge is the age of the images reported as stale, when none is configured
+const DefaultStaleImageAge = 90 * 24 * time.Hour
+
+// DefaultNamespaceExcludes are the patterns of the system namespaces excluded when no other namespace filter is given
+const DefaultNamespaceExcludes = "openshift-*,kube-*"
+
 type RunnerConfig struct {
-	environment       string
-	namespaceSelector string
+	environment          string
+	clusters             []string
+	namespaceSelector    string
+	namespaces           []string
+	namespaceIncludes    []string
+	namespaceExcludes    []string
+	namespaceAnnotations string
+
+	workloadSelector string
+	kinds            []string
 
 	outputFileName string
 }
@@ -159,11 +240,22 @@ func NewConfig() *Config {
 	config.logLevel = "info"
 	config.contentType = Text
 	config.withResources = false
+	config.timeout = 0
+	config.requestTimeout = 30 * time.Second
+	config.imageCacheTTL = DefaultImageCacheTTL
+	config.staleImageAge = DefaultStaleImageAge
 
 	config.runnerConfig = NewRunnerConfig()
 
 	config.initFromFlags()
 	config.initFromEnvVars()
+	config.initCustomKinds()
+	if config.imageCacheFile != "" && !config.imageCacheTTLSet {
+		config.imageCacheTTL = DefaultPersistentImageCacheTTL
+	}
+	if err := config.runnerConfig.ValidateKinds(config.customKinds); err != nil {
+		log.Fatalf("Cannot parse kinds: %s", err)
+	}
 
 	return &config
 }
@@ -179,7 +271,22 @@ func NewRunnerConfig() *RunnerConfig {
 func NewRunnerConfigFromProperties(p *properties.Properties) *RunnerConfig {
 	runnerConfig := RunnerConfig{}
 	runnerConfig.environment = p.GetString("environment", "default")
+	runnerConfig.SetClusters(p.GetString("clusters", ""))
 	runnerConfig.namespaceSelector = p.GetString("ns-selector", "")
+	runnerConfig.SetNamespaces(p.GetString("namespaces", ""))
+	if err := runnerConfig.SetNamespaceIncludes(p.GetString("ns-include", "")); err != nil {
+		log.Fatalf("Cannot parse ns-include property: %s", err)
+	}
+	if err := runnerConfig.SetNamespaceExcludes(p.GetString("ns-exclude", "")); err != nil {
+		log.Fatalf("Cannot parse ns-exclude property: %s", err)
+	}
+	if err := runnerConfig.SetNamespaceAnnotations(p.GetString("ns-annotations", "")); err != nil {
+		log.Fatalf("Cannot parse ns-annotations property: %s", err)
+	}
+	if err := runnerConfig.SetWorkloadSelector(p.GetString("workload-selector", "")); err != nil {
+		log.Fatalf("Cannot parse workload-selector property: %s", err)
+	}
+	runnerConfig.SetKinds(p.GetString("kinds", ""))
 	runnerConfig.outputFileName = p.GetString("output", "output")
 	return &runnerConfig
 }
@@ -191,12 +298,43 @@ func (c *Config) initFromFlags() {
 	contentType := flag.String("content-type", "text", "Content type, one of text, CSV")
 	c.contentType = ContentTypeFromString(*contentType)
 	flag.BoolVar(&c.withResources, "with-resources", false, "Include resource configuration and usage")
+	containerRoles := flag.String("container-roles", "", "Container roles to report, like main,init (default is all of main, init, sidecar and ephemeral)")
 	flag.IntVar(&c.burst, "burst", 40, "Maximum burst for throttle")
+	flag.StringVar(&c.customKindsFileName, "custom-kinds", "", "Properties file declaring the custom workload kinds to collect")
+	flag.DurationVar(&c.timeout, "timeout", 0, "Overall timeout of the data collection, like 30s or 5m (0 means no timeout)")
+	flag.DurationVar(&c.requestTimeout, "request-timeout", 30*time.Second, "Timeout of every single request to the cluster API (0 means no timeout)")
+
+	flag.StringVar(&c.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file (default is the KUBECONFIG paths, or ~/.kube/config, or the in-cluster configuration)")
+	flag.StringVar(&c.context, "context", "", "Name of the kubeconfig context to use (default is the current context)")
+	flag.StringVar(&c.namespace, "namespace", "", "Namespace of the kubeconfig context, collected when the namespaces cannot be listed")
+	flag.StringVar(&c.as, "as", "", "User to impersonate for the cluster API requests")
+
+	versionStrategies := flag.String("version-strategies", DefaultVersionStrategies, "Ordered strategies to extract the image versions, any of tag, oci-label, label, env")
+	versionTagRegexp := flag.String("version-tag-regexp", "", "Regular expression extracting the version from the image tag, as its first group if any, like ^v?([0-9.]+)")
+	versionEnvVars := flag.String("version-env-vars", DefaultVersionEnvVars, "Environment variables holding the image version, for the env strategy")
+	flag.StringVar(&c.versionFallback, "version-fallback", DefaultVersionFallback, "Image version reported when no strategy finds one")
+	flag.BoolVar(&c.registryLookup, "registry-lookup", false, "Fetch the configuration of the images not in an ImageStream from their registries")
+	flag.StringVar(&c.registryCredentials, "registry-credentials", "", "Docker config file with the registry credentials, in addition to the pull secrets of the workloads")
+	flag.StringVar(&c.registryCacheDir, "registry-cache", "", "Directory caching the image configurations fetched from the registries (default is no disk cache)")
+	flag.DurationVar(&c.imageCacheTTL, "image-cache-ttl", DefaultImageCacheTTL, "Time the ImageStreamImages are reused by the following collections, like 10m or 24h (0 means only in the same collection, default is 168h with -image-cache-file)")
+	flag.DurationVar(&c.staleImageAge, "stale-image-age", DefaultStaleImageAge, "Age of the images reported as stale, like 720h (0 means no staleness report)")
+	flag.BoolVar(&c.verifyBuilds, "verify-builds", false, "Cross-check the provenance of the images built in OpenShift with their Builds")
+	flag.StringVar(&c.imageCacheFile, "image-cache-file", "", "File persisting the ImageStreamImages across the executions, like in script mode (default is no file)")
 
 	flag.StringVar(&c.runnerConfig.environment, "environment", "default", "Global environment name to tag Prometheus metrics")
+	clusters := flag.String("clusters", "", "Global list of kubeconfig contexts or kubeconfig files of the clusters to collect, like ctx1,ctx2 (default is the current context)")
 	flag.StringVar(&c.runnerConfig.namespaceSelector, "ns-selector", "", "Global namespace selector, like label1=value1,label2=value2")
+	namespaceIncludes := flag.String("ns-include", "", "Global namespace name patterns to include, as globs like app-* or regular expressions like /^app-[0-9]+$/")
+	namespaceExcludes := flag.String("ns-exclude", "", "Global namespace name patterns to exclude, as globs or regular expressions (default is "+DefaultNamespaceExcludes+" when no other namespace filter is given)")
+	flag.StringVar(&c.runnerConfig.namespaceAnnotations, "ns-annotations", "", "Global namespace annotation selector, like annotation1=value1,annotation2")
+	flag.StringVar(&c.runnerConfig.workloadSelector, "workload-selector", "", "Global workload label selector, like app.kubernetes.io/part-of=billing")
+	kinds := flag.String("kinds", "", "Global workload kinds to collect, like Deployment,StatefulSet (default is all kinds)")
+	namespaces := flag.String("namespaces", "", "Global list of namespaces to collect without listing them, like ns1,ns2 (overrides -ns-selector)")
 	outputFileName := flag.String("output", "", "Global output file name, default is output.<content-type>. File suffix is automatically added")
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		c.imageCacheTTLSet = c.imageCacheTTLSet || f.Name == "image-cache-ttl"
+	})
 
 	if *runMode != "" {
 		c.runAs = RunAsFromString(*runMode)
@@ -204,6 +342,29 @@ func (c *Config) initFromFlags() {
 	if *outputFileName != "" {
 		c.runnerConfig.outputFileName = *outputFileName
 	}
+	c.SetContainerRoles(*containerRoles)
+	if err := c.SetVersionStrategies(*versionStrategies); err != nil {
+		log.Fatalf("Cannot parse version-strategies argument: %s", err)
+	}
+	if err := c.SetVersionTagRegexp(*versionTagRegexp); err != nil {
+		log.Fatalf("Cannot parse version-tag-regexp argument: %s", err)
+	}
+	c.SetVersionEnvVars(*versionEnvVars)
+	c.runnerConfig.SetClusters(*clusters)
+	c.runnerConfig.SetNamespaces(*namespaces)
+	if err := c.runnerConfig.SetNamespaceIncludes(*namespaceIncludes); err != nil {
+		log.Fatalf("Cannot parse ns-include argument: %s", err)
+	}
+	if err := c.runnerConfig.SetNamespaceExcludes(*namespaceExcludes); err != nil {
+		log.Fatalf("Cannot parse ns-exclude argument: %s", err)
+	}
+	if err := c.runnerConfig.SetNamespaceAnnotations(c.runnerConfig.namespaceAnnotations); err != nil {
+		log.Fatalf("Cannot parse ns-annotations argument: %s", err)
+	}
+	if err := c.runnerConfig.SetWorkloadSelector(c.runnerConfig.workloadSelector); err != nil {
+		log.Fatalf("Cannot parse workload-selector argument: %s", err)
+	}
+	c.runnerConfig.SetKinds(*kinds)
 }
 
 func (c *Config) initFromEnvVars() {
@@ -213,12 +374,19 @@ func (c *Config) initFromEnvVars() {
 	if _, ok := os.LookupEnv("IN_CONTAINER"); ok {
 		c.runIn = Container
 	}
+	// Set by Kubernetes in every container
+	if _, ok := os.LookupEnv("KUBERNETES_SERVICE_HOST"); ok {
+		c.runIn = Container
+	}
 	if v, ok := os.LookupEnv("LOG_LEVEL"); ok {
 		c.logLevel = v
 	}
 	if v, ok := os.LookupEnv("CONTENT_TYPE"); ok {
 		c.contentType = ContentTypeFromString(v)
 	}
+	if v, ok := os.LookupEnv("CONTAINER_ROLES"); ok {
+		c.SetContainerRoles(v)
+	}
 	if v, ok := os.LookupEnv("SERVER_PORT"); ok {
 		var err error
 		c.serverPort, err = strconv.Atoi(v)
@@ -226,13 +394,119 @@ func (c *Config) initFromEnvVars() {
 			log.Fatalf("Cannot parse SERVER_PORT variable %s", v)
 		}
 	}
+	if v, ok := os.LookupEnv("CUSTOM_KINDS"); ok {
+		c.customKindsFileName = v
+	}
+	if v, ok := os.LookupEnv("TIMEOUT"); ok {
+		var err error
+		c.timeout, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Cannot parse TIMEOUT variable %s", v)
+		}
+	}
+	if v, ok := os.LookupEnv("REQUEST_TIMEOUT"); ok {
+		var err error
+		c.requestTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Cannot parse REQUEST_TIMEOUT variable %s", v)
+		}
+	}
+	if v, ok := os.LookupEnv("VERSION_STRATEGIES"); ok {
+		if err := c.SetVersionStrategies(v); err != nil {
+			log.Fatalf("Cannot parse VERSION_STRATEGIES variable %s: %s", v, err)
+		}
+	}
+	if v, ok := os.LookupEnv("VERSION_TAG_REGEXP"); ok {
+		if err := c.SetVersionTagRegexp(v); err != nil {
+			log.Fatalf("Cannot parse VERSION_TAG_REGEXP variable %s: %s", v, err)
+		}
+	}
+	if v, ok := os.LookupEnv("VERSION_ENV_VARS"); ok {
+		c.SetVersionEnvVars(v)
+	}
+	if v, ok := os.LookupEnv("VERSION_FALLBACK"); ok {
+		c.versionFallback = v
+	}
+	if _, ok := os.LookupEnv("REGISTRY_LOOKUP"); ok {
+		c.registryLookup = true
+	}
+	if v, ok := os.LookupEnv("REGISTRY_CREDENTIALS"); ok {
+		c.registryCredentials = v
+	}
+	if v, ok := os.LookupEnv("REGISTRY_CACHE"); ok {
+		c.registryCacheDir = v
+	}
+	if v, ok := os.LookupEnv("IMAGE_CACHE_TTL"); ok {
+		var err error
+		c.imageCacheTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Cannot parse IMAGE_CACHE_TTL variable %s", v)
+		}
+		c.imageCacheTTLSet = true
+	}
+	if v, ok := os.LookupEnv("IMAGE_CACHE_FILE"); ok {
+		c.imageCacheFile = v
+	}
+	if _, ok := os.LookupEnv("VERIFY_BUILDS"); ok {
+		c.verifyBuilds = true
+	}
+	if v, ok := os.LookupEnv("STALE_IMAGE_AGE"); ok {
+		var err error
+		c.staleImageAge, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Cannot parse STALE_IMAGE_AGE variable %s", v)
+		}
+	}
 
 	if v, ok := os.LookupEnv("ENVIRONMENT"); ok {
 		c.runnerConfig.environment = v
 	}
+	if v, ok := os.LookupEnv("CLUSTERS"); ok {
+		c.runnerConfig.SetClusters(v)
+	}
 	if v, ok := os.LookupEnv("NS_SELECTOR"); ok {
 		c.runnerConfig.namespaceSelector = v
 	}
+	if v, ok := os.LookupEnv("NAMESPACES"); ok {
+		c.runnerConfig.SetNamespaces(v)
+	}
+	if v, ok := os.LookupEnv("NS_INCLUDE"); ok {
+		if err := c.runnerConfig.SetNamespaceIncludes(v); err != nil {
+			log.Fatalf("Cannot parse NS_INCLUDE variable %s: %s", v, err)
+		}
+	}
+	if v, ok := os.LookupEnv("NS_EXCLUDE"); ok {
+		if err := c.runnerConfig.SetNamespaceExcludes(v); err != nil {
+			log.Fatalf("Cannot parse NS_EXCLUDE variable %s: %s", v, err)
+		}
+	}
+	if v, ok := os.LookupEnv("NS_ANNOTATIONS"); ok {
+		if err := c.runnerConfig.SetNamespaceAnnotations(v); err != nil {
+			log.Fatalf("Cannot parse NS_ANNOTATIONS variable %s: %s", v, err)
+		}
+	}
+	if v, ok := os.LookupEnv("WORKLOAD_SELECTOR"); ok {
+		if err := c.runnerConfig.SetWorkloadSelector(v); err != nil {
+			log.Fatalf("Cannot parse WORKLOAD_SELECTOR variable %s: %s", v, err)
+		}
+	}
+	if v, ok := os.LookupEnv("KINDS"); ok {
+		c.runnerConfig.SetKinds(v)
+	}
+}
+
+func (c *Config) initCustomKinds() {
+	if c.customKindsFileName == "" {
+		return
+	}
+	p, err := properties.LoadFile(c.customKindsFileName, properties.UTF8)
+	if err != nil {
+		log.Fatalf("Cannot read custom kinds file %s: %s", c.customKindsFileName, err)
+	}
+	c.customKinds, err = NewCustomKindsFromProperties(p)
+	if err != nil {
+		log.Fatalf("Cannot load custom kinds from %s: %s", c.customKindsFileName, err)
+	}
 }
 
 func (c *Config) String() string {
@@ -240,8 +514,9 @@ func (c *Config) String() string {
 	if c.RunAsScript() {
 		serverPort = "NA"
 	}
-	return fmt.Sprintf("Run as: %s, Run in: %v,  Server port: %s, Log level: %s, , Content type: %s, With resources: %v, Burst: %d",
-		c.runAs, c.runIn, serverPort, c.logLevel, c.contentType, c.withResources, c.burst)
+	return fmt.Sprintf("Run as: %s, Run in: %v,  Server port: %s, Log level: %s, , Content type: %s, With resources: %v, Container roles: %v, Burst: %d, Timeout: %s, Request timeout: %s, Kubeconfig: \"%s\", Context: \"%s\", Namespace: \"%s\", As: \"%s\", Version strategies: %v, Version tag regexp: \"%v\", Version env vars: %v, Version fallback: %s, Registry lookup: %v, Registry credentials: \"%s\", Registry cache: \"%s\", Image cache TTL: %s, Image cache file: \"%s\", Verify builds: %v, Stale image age: %s",
+		c.runAs, c.runIn, serverPort, c.logLevel, c.contentType, c.withResources, c.containerRoles, c.burst, c.timeout, c.requestTimeout, c.kubeconfig, c.context, c.namespace, c.as,
+		c.VersionStrategies(), c.versionTagRegexp, c.VersionEnvVars(), c.VersionFallback(), c.registryLookup, c.registryCredentials, c.registryCacheDir, c.imageCacheTTL, c.imageCacheFile, c.verifyBuilds, c.staleImageAge)
 }
 func (c *Config) RunAsScript() bool {
 	return c.runAs == Script
@@ -271,9 +546,94 @@ func (c *Config) ContentType() ContentType {
 func (c *Config) WithResources() bool {
 	return c.withResources
 }
+func (c *Config) ContainerRoles() []string {
+	return c.containerRoles
+}
+
+// WithContainerRole returns true if the containers of the given role must be reported
+func (c *Config) WithContainerRole(role string) bool {
+	if len(c.containerRoles) == 0 {
+		return true
+	}
+	for _, r := range c.containerRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+func (c *Config) CustomKinds() []*CustomKind {
+	return c.customKinds
+}
 func (c *Config) Burst() int {
 	return c.burst
 }
+func (c *Config) Timeout() time.Duration {
+	return c.timeout
+}
+func (c *Config) RequestTimeout() time.Duration {
+	return c.requestTimeout
+}
+
+func (c *Config) Kubeconfig() string {
+	return c.kubeconfig
+}
+func (c *Config) Context() string {
+	return c.context
+}
+func (c *Config) Namespace() string {
+	return c.namespace
+}
+func (c *Config) As() string {
+	return c.as
+}
+
+// VersionStrategies returns the ordered strategies to extract the image versions, or the DefaultVersionStrategies
+func (c *Config) VersionStrategies() []string {
+	if len(c.versionStrategies) == 0 {
+		return strings.Split(DefaultVersionStrategies, ",")
+	}
+	return c.versionStrategies
+}
+
+// VersionTagRegexp returns the regular expression extracting the version from the image tag, or nil to use the whole tag
+func (c *Config) VersionTagRegexp() *regexp.Regexp {
+	return c.versionTagRegexp
+}
+func (c *Config) VersionEnvVars() []string {
+	if c.versionEnvVars == nil {
+		return strings.Split(DefaultVersionEnvVars, ",")
+	}
+	return c.versionEnvVars
+}
+func (c *Config) VersionFallback() string {
+	if c.versionFallback == "" {
+		return DefaultVersionFallback
+	}
+	return c.versionFallback
+}
+
+func (c *Config) RegistryLookup() bool {
+	return c.registryLookup
+}
+func (c *Config) RegistryCredentials() string {
+	return c.registryCredentials
+}
+func (c *Config) RegistryCacheDir() string {
+	return c.registryCacheDir
+}
+func (c *Config) ImageCacheTTL() time.Duration {
+	return c.imageCacheTTL
+}
+func (c *Config) ImageCacheFile() string {
+	return c.imageCacheFile
+}
+func (c *Config) VerifyBuilds() bool {
+	return c.verifyBuilds
+}
+func (c *Config) StaleImageAge() time.Duration {
+	return c.staleImageAge
+}
 
 func (c *Config) SetContentType(contentType ContentType) {
 	c.contentType = contentType
@@ -281,9 +641,97 @@ func (c *Config) SetContentType(contentType ContentType) {
 func (c *Config) SetWithResources(withResources bool) {
 	c.withResources = withResources
 }
+func (c *Config) SetContainerRoles(containerRoles string) {
+	c.containerRoles = nil
+	for _, role := range strings.Split(containerRoles, ",") {
+		if role = strings.ToLower(strings.TrimSpace(role)); role != "" {
+			c.containerRoles = append(c.containerRoles, role)
+		}
+	}
+}
+func (c *Config) SetVersionStrategies(versionStrategies string) error {
+	var strategies []string
+	for _, strategy := range strings.Split(versionStrategies, ",") {
+		if strategy = strings.ToLower(strings.TrimSpace(strategy)); strategy == "" {
+			continue
+		}
+		valid := false
+		for _, name := range versionStrategyNames {
+			valid = valid || name == strategy
+		}
+		if !valid {
+			return fmt.Errorf("unknown version strategy %s, expected any of %s", strategy, strings.Join(versionStrategyNames, ", "))
+		}
+		strategies = append(strategies, strategy)
+	}
+	c.versionStrategies = strategies
+	return nil
+}
+func (c *Config) SetVersionTagRegexp(versionTagRegexp string) error {
+	if versionTagRegexp == "" {
+		c.versionTagRegexp = nil
+		return nil
+	}
+	expr, err := regexp.Compile(versionTagRegexp)
+	if err != nil {
+		return err
+	}
+	c.versionTagRegexp = expr
+	return nil
+}
+func (c *Config) SetVersionEnvVars(versionEnvVars string) {
+	c.versionEnvVars = []string{}
+	for _, name := range strings.Split(versionEnvVars, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			c.versionEnvVars = append(c.versionEnvVars, name)
+		}
+	}
+}
+func (c *Config) SetVersionFallback(versionFallback string) {
+	c.versionFallback = versionFallback
+}
+func (c *Config) SetRegistryLookup(registryLookup bool) {
+	c.registryLookup = registryLookup
+}
+func (c *Config) SetRegistryCredentials(registryCredentials string) {
+	c.registryCredentials = registryCredentials
+}
+func (c *Config) SetRegistryCacheDir(registryCacheDir string) {
+	c.registryCacheDir = registryCacheDir
+}
+func (c *Config) SetImageCacheTTL(imageCacheTTL time.Duration) {
+	c.imageCacheTTL = imageCacheTTL
+}
+func (c *Config) SetImageCacheFile(imageCacheFile string) {
+	c.imageCacheFile = imageCacheFile
+}
+func (c *Config) SetVerifyBuilds(verifyBuilds bool) {
+	c.verifyBuilds = verifyBuilds
+}
+func (c *Config) SetStaleImageAge(staleImageAge time.Duration) {
+	c.staleImageAge = staleImageAge
+}
+func (c *Config) SetCustomKinds(customKinds []*CustomKind) {
+	c.customKinds = customKinds
+}
 func (c *Config) SetBurst(burst int) {
 	c.burst = burst
 }
+func (c *Config) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+func (c *Config) SetKubeconfig(kubeconfig string) {
+	c.kubeconfig = kubeconfig
+}
+func (c *Config) SetContext(context string) {
+	c.context = context
+}
+func (c *Config) SetNamespace(namespace string) {
+	c.namespace = namespace
+}
+func (c *Config) SetAs(as string) {
+	c.as = as
+}
 
 func (c *Config) GlobalRunnerConfig() *RunnerConfig {
 	return c.runnerConfig
@@ -292,20 +740,285 @@ func (c *Config) GlobalRunnerConfig() *RunnerConfig {
 func (c *RunnerConfig) Environment() string {
 	return c.environment
 }
+func (c *RunnerConfig) Clusters() []string {
+	return c.clusters
+}
 func (c *RunnerConfig) NamespaceSelector() string {
 	return c.namespaceSelector
 }
+func (c *RunnerConfig) Namespaces() []string {
+	return c.namespaces
+}
+func (c *RunnerConfig) NamespaceIncludes() []string {
+	return c.namespaceIncludes
+}
+
+// NamespaceExcludes returns the configured exclude patterns, or the DefaultNamespaceExcludes when neither a namespace
+// selector nor any include pattern is given
+func (c *RunnerConfig) NamespaceExcludes() []string {
+	if len(c.namespaceExcludes) == 0 && c.namespaceSelector == "" && len(c.namespaceIncludes) == 0 {
+		excludes, _ := parseNamePatterns(DefaultNamespaceExcludes)
+		return excludes
+	}
+	return c.namespaceExcludes
+}
+func (c *RunnerConfig) NamespaceAnnotations() string {
+	return c.namespaceAnnotations
+}
+
+// MatchesNamespace returns true if the namespace with the given name and annotations matches any include pattern,
+// none of the exclude patterns and the annotation selector
+func (c *RunnerConfig) MatchesNamespace(name string, annotations map[string]string) bool {
+	if len(c.namespaceIncludes) > 0 && !matchesAnyNamePattern(c.namespaceIncludes, name) {
+		return false
+	}
+	if matchesAnyNamePattern(c.NamespaceExcludes(), name) {
+		return false
+	}
+	selector, err := labels.Parse(c.namespaceAnnotations)
+	return err == nil && selector.Matches(labels.Set(annotations))
+}
+
+// MatchesNamespaceName returns true if the namespace with the given name matches any include pattern and none of the
+// configured exclude patterns. It's meant for the namespaces given by name, which are not excluded by the
+// DefaultNamespaceExcludes
+func (c *RunnerConfig) MatchesNamespaceName(name string) bool {
+	if len(c.namespaceIncludes) > 0 && !matchesAnyNamePattern(c.namespaceIncludes, name) {
+		return false
+	}
+	return !matchesAnyNamePattern(c.namespaceExcludes, name)
+}
+func (c *RunnerConfig) WorkloadSelector() string {
+	return c.workloadSelector
+}
+func (c *RunnerConfig) Kinds() []string {
+	return c.kinds
+}
+
+// WithKind returns true if the workloads of the given kind must be collected
+func (c *RunnerConfig) WithKind(kind string) bool {
+	if len(c.kinds) == 0 {
+		return true
+	}
+	for _, k := range c.kinds {
+		if strings.EqualFold(k, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithCustomKind returns true if the workloads of the given custom kind must be collected, selected either by the name
+// of the custom kind or by its Kind
+func (c *RunnerConfig) WithCustomKind(customKind *CustomKind) bool {
+	return c.WithKind(customKind.Name()) || c.WithKind(customKind.Kind())
+}
+
+// ValidateKinds returns an error if any of the selected kinds is neither a built-in workload kind nor one of the given
+// custom kinds
+func (c *RunnerConfig) ValidateKinds(customKinds []*CustomKind) error {
+	supportedKinds := append([]string{}, WorkloadKinds...)
+	for _, customKind := range customKinds {
+		supportedKinds = append(supportedKinds, customKind.Name(), customKind.Kind())
+	}
+	for _, kind := range c.kinds {
+		supported := false
+		for _, supportedKind := range supportedKinds {
+			supported = supported || strings.EqualFold(kind, supportedKind)
+		}
+		if !supported {
+			return fmt.Errorf("unsupported kind %s, expected one of %s", kind, strings.Join(supportedKinds, ","))
+		}
+	}
+	return nil
+}
+
+// WithWorkloadFilters returns true if the workloads are filtered by label or kind
+func (c *RunnerConfig) WithWorkloadFilters() bool {
+	return c.workloadSelector != "" || len(c.kinds) > 0
+}
 func (c *RunnerConfig) OutputFileName() string {
 	return c.outputFileName
 }
 
+func (c *RunnerConfig) SetClusters(clusters string) {
+	c.clusters = nil
+	for _, cluster := range strings.Split(clusters, ",") {
+		if cluster = strings.TrimSpace(cluster); cluster != "" {
+			c.clusters = append(c.clusters, cluster)
+		}
+	}
+}
 func (c *RunnerConfig) SetNamespaceSelector(namespaceSelector string) {
 	c.namespaceSelector = namespaceSelector
 }
+func (c *RunnerConfig) SetNamespaces(namespaces string) {
+	c.namespaces = nil
+	for _, namespace := range strings.Split(namespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			c.namespaces = append(c.namespaces, namespace)
+		}
+	}
+}
+func (c *RunnerConfig) SetNamespaceIncludes(patterns string) error {
+	namespaceIncludes, err := parseNamePatterns(patterns)
+	if err != nil {
+		return err
+	}
+	c.namespaceIncludes = namespaceIncludes
+	return nil
+}
+func (c *RunnerConfig) SetNamespaceExcludes(patterns string) error {
+	namespaceExcludes, err := parseNamePatterns(patterns)
+	if err != nil {
+		return err
+	}
+	c.namespaceExcludes = namespaceExcludes
+	return nil
+}
+func (c *RunnerConfig) SetNamespaceAnnotations(namespaceAnnotations string) error {
+	if _, err := labels.Parse(namespaceAnnotations); err != nil {
+		return err
+	}
+	c.namespaceAnnotations = namespaceAnnotations
+	return nil
+}
+func (c *RunnerConfig) SetWorkloadSelector(workloadSelector string) error {
+	if _, err := labels.Parse(workloadSelector); err != nil {
+		return err
+	}
+	c.workloadSelector = workloadSelector
+	return nil
+}
+func (c *RunnerConfig) SetKinds(kinds string) {
+	c.kinds = nil
+	for _, kind := range strings.Split(kinds, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			c.kinds = append(c.kinds, kind)
+		}
+	}
+}
 func (c *RunnerConfig) SetOutputFileName(outputFileName string) {
 	c.outputFileName = outputFileName
 }
 
 func (r *RunnerConfig) String() string {
-	return fmt.Sprintf("Environment: %s, Namespace selector: \"%s\", Output filename: %s", r.environment, r.namespaceSelector, r.outputFileName)
+	return fmt.Sprintf("Environment: %s, Clusters: %v, Namespace selector: \"%s\", Namespaces: %v, Namespace includes: %v, Namespace excludes: %v, Namespace annotations: \"%s\", Workload selector: \"%s\", Kinds: %v, Output filename: %s",
+		r.environment, r.clusters, r.namespaceSelector, r.namespaces, r.namespaceIncludes, r.NamespaceExcludes(), r.namespaceAnnotations, r.workloadSelector, r.kinds, r.outputFileName)
+}
+
+// parseNamePatterns splits the given comma separated patterns, which are either globs like app-* or regular
+// expressions enclosed in slashes like /^app-[0-9]+$/
+func parseNamePatterns(patterns string) ([]string, error) {
+	var namePatterns []string
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if expr, ok := regexpOf(pattern); ok {
+			if _, err := regexp.Compile(expr); err != nil {
+				return nil, fmt.Errorf("invalid regular expression %s: %w", pattern, err)
+			}
+		} else if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+		namePatterns = append(namePatterns, pattern)
+	}
+	return namePatterns, nil
+}
+
+func regexpOf(pattern string) (string, bool) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return pattern[1 : len(pattern)-1], true
+	}
+	return "", false
+}
+
+func matchesAnyNamePattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if expr, ok := regexpOf(pattern); ok {
+			if matched, _ := regexp.MatchString(expr, name); matched {
+				return true
+			}
+		} else if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkloadKinds are the built-in workload kinds which can be selected with the kinds filter
+var WorkloadKinds = []string{"Deployment", "StatefulSet", "DeploymentConfig", "CronJob", "DaemonSet", "KnativeService", "Job", "ReplicaSet", "Pod"}
+
+// CustomKind is a custom workload kind to collect with the dynamic client. The containers are found either in the pod
+// template or in the list of containers at the given JSONPath
+type CustomKind struct {
+	name            string
+	kind            string
+	resource        schema.GroupVersionResource
+	podTemplatePath string
+	containersPath  string
+}
+
+// NewCustomKindsFromProperties loads the custom kinds listed in the kinds property, each one defined by the properties
+// prefixed by its name, like:
+//
+//	kinds=rollout
+//	rollout.resource=rollouts.v1alpha1.argoproj.io
+//	rollout.pod-template={.spec.template}
+//
+// The Kind of the workloads, like Rollout, can be given by the kind property, and defaults to the singular of the
+// resource
+func NewCustomKindsFromProperties(p *properties.Properties) ([]*CustomKind, error) {
+	var customKinds []*CustomKind
+	for _, name := range strings.Split(p.GetString("kinds", ""), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		customKind := CustomKind{name: name}
+		resource, _ := schema.ParseResourceArg(p.GetString(name+".resource", ""))
+		if resource == nil || resource.Version == "" {
+			return nil, fmt.Errorf("missing or invalid %s.resource, expected like resources.version.group", name)
+		}
+		customKind.resource = *resource
+		customKind.kind = p.GetString(name+".kind", singularOf(resource.Resource))
+		customKind.podTemplatePath = p.GetString(name+".pod-template", "")
+		customKind.containersPath = p.GetString(name+".containers", "")
+		if (customKind.podTemplatePath == "") == (customKind.containersPath == "") {
+			return nil, fmt.Errorf("expected one of %s.pod-template or %s.containers", name, name)
+		}
+		customKinds = append(customKinds, &customKind)
+	}
+	return customKinds, nil
+}
+
+// singularOf returns the singular of the given plural resource, like rollout for rollouts or policy for policies
+func singularOf(resource string) string {
+	switch {
+	case strings.HasSuffix(resource, "ies"):
+		return strings.TrimSuffix(resource, "ies") + "y"
+	case strings.HasSuffix(resource, "sses"), strings.HasSuffix(resource, "xes"), strings.HasSuffix(resource, "ches"), strings.HasSuffix(resource, "shes"):
+		return strings.TrimSuffix(resource, "es")
+	}
+	return strings.TrimSuffix(resource, "s")
+}
+
+func (k *CustomKind) Name() string {
+	return k.name
+}
+func (k *CustomKind) Kind() string {
+	return k.kind
+}
+func (k *CustomKind) Resource() schema.GroupVersionResource {
+	return k.resource
+}
+func (k *CustomKind) PodTemplatePath() string {
+	return k.podTemplatePath
+}
+func (k *CustomKind) ContainersPath() string {
+	return k.containersPath
+}
+
+func (k *CustomKind) String() string {
+	return fmt.Sprintf("%s (%s)", k.name, k.resource)
 }
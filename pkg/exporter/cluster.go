@@ -0,0 +1,102 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	cfg "github.com/dmartinol/application-exporter/pkg/config"
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// InClusterName is the name of the cluster where the exporter runs, when it connects with its service account
+const InClusterName = "in-cluster"
+
+// Cluster is a connected cluster, named after its kubeconfig context
+type Cluster struct {
+	Name string
+	// Namespace of the context, collected when the namespaces cannot be listed
+	Namespace  string
+	RestConfig *rest.Config
+}
+
+// connectClusters connects the given clusters, each one being either a context of the configured kubeconfig or another
+// kubeconfig file, using its current context. When no clusters are given, the configured context is connected.
+// The kubeconfig is loaded with the standard client-go rules, e.g. from the -kubeconfig argument, or the KUBECONFIG
+// paths, or ~/.kube/config, and falls back to the in-cluster configuration when none is found.
+// The clusters which cannot be connected are skipped: their errors are returned together with the connected clusters,
+// which are nil only when none of the clusters can be connected
+func connectClusters(config *cfg.Config, clusters []string) ([]*Cluster, error) {
+	if len(clusters) == 0 {
+		cluster, err := connectContext(config, loadingRules(config.Kubeconfig()), config.Context())
+		if err != nil {
+			return nil, err
+		}
+		return []*Cluster{cluster}, nil
+	}
+
+	if config.Context() != "" {
+		logger.Warnf("Disregarding context %s for the configured clusters", config.Context())
+	}
+	var connected []*Cluster
+	var errs []error
+	for _, name := range clusters {
+		var cluster *Cluster
+		var err error
+		if info, statErr := os.Stat(name); statErr == nil && !info.IsDir() {
+			cluster, err = connectContext(config, loadingRules(name), "")
+		} else {
+			cluster, err = connectContext(config, loadingRules(config.Kubeconfig()), name)
+		}
+		if err != nil {
+			logger.Warnf("Cannot connect cluster %s: %s", name, err)
+			errs = append(errs, fmt.Errorf("cannot connect cluster %s: %w", name, err))
+			continue
+		}
+		connected = append(connected, cluster)
+	}
+	return connected, errors.Join(errs...)
+}
+
+func loadingRules(kubeconfig string) *clientcmd.ClientConfigLoadingRules {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	return loadingRules
+}
+
+// connectContext connects the given context, or the current one if empty, applying the configured namespace and
+// impersonated user
+func connectContext(config *cfg.Config, loadingRules *clientcmd.ClientConfigLoadingRules, context string) (*Cluster, error) {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	overrides.Context.Namespace = config.Namespace()
+	overrides.AuthInfo.Impersonate = config.As()
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	// Not applied by the in-cluster configuration
+	if config.As() != "" {
+		restConfig.Impersonate.UserName = config.As()
+	}
+
+	if context == "" {
+		rawConfig, err := clientConfig.RawConfig()
+		if err != nil {
+			return nil, err
+		}
+		context = rawConfig.CurrentContext
+	}
+	cluster := &Cluster{Name: context, RestConfig: restConfig}
+	if cluster.Name == "" {
+		cluster.Name = InClusterName
+	}
+	cluster.Namespace, _, err = clientConfig.Namespace()
+	if err != nil {
+		logger.Warnf("Cannot detect the current namespace of %s: %s", cluster.Name, err)
+	}
+	logger.Infof("Connected cluster %s", cluster.Name)
+	return cluster, nil
+}
@@ -0,0 +1,237 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dmartinol/application-exporter/pkg/config"
+	"github.com/dmartinol/application-exporter/pkg/model"
+	"k8s.io/client-go/rest"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: east
+  cluster:
+    server: https://east.example.com:6443
+- name: west
+  cluster:
+    server: https://west.example.com:6443
+users:
+- name: admin
+  user:
+    token: secret
+contexts:
+- name: east-admin
+  context:
+    cluster: east
+    user: admin
+    namespace: billing
+- name: west-admin
+  context:
+    cluster: west
+    user: admin
+current-context: east-admin
+`
+
+func writeKubeconfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Cannot write kubeconfig: %s", err)
+	}
+	return path
+}
+
+func TestConnectClusters(t *testing.T) {
+	kubeconfig := writeKubeconfig(t, "config", testKubeconfig)
+	config := &config.Config{}
+	config.SetKubeconfig(kubeconfig)
+
+	clusters, err := connectClusters(config, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(clusters) != 1 || clusters[0].Name != "east-admin" || clusters[0].Namespace != "billing" {
+		t.Fatalf("Expected the current context east-admin, got %+v", clusters)
+	}
+
+	otherKubeconfig := writeKubeconfig(t, "other", testKubeconfig)
+	clusters, err = connectClusters(config, []string{"west-admin", otherKubeconfig})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(clusters) != 2 {
+		t.Fatalf("Expected 2 clusters, got %d", len(clusters))
+	}
+	if clusters[0].Name != "west-admin" || clusters[0].RestConfig.Host != "https://west.example.com:6443" || clusters[0].Namespace != "default" {
+		t.Errorf("Unexpected cluster %s on %s, namespace %s", clusters[0].Name, clusters[0].RestConfig.Host, clusters[0].Namespace)
+	}
+	if clusters[1].Name != "east-admin" || clusters[1].RestConfig.Host != "https://east.example.com:6443" {
+		t.Errorf("Unexpected cluster %s on %s", clusters[1].Name, clusters[1].RestConfig.Host)
+	}
+
+	clusters, err = connectClusters(config, []string{"missing", "west-admin"})
+	if err == nil || !strings.Contains(err.Error(), "cannot connect cluster missing") {
+		t.Errorf("Expected error for missing context, got %v", err)
+	}
+	if len(clusters) != 1 || clusters[0].Name != "west-admin" {
+		t.Errorf("Expected only the connected cluster west-admin, got %+v", clusters)
+	}
+	if clusters, err = connectClusters(config, []string{"missing"}); err == nil || clusters != nil {
+		t.Errorf("Expected error and no clusters for missing context, got %+v", clusters)
+	}
+}
+
+func TestConnectContextOverrides(t *testing.T) {
+	config := &config.Config{}
+	config.SetKubeconfig(writeKubeconfig(t, "config", testKubeconfig))
+	config.SetContext("west-admin")
+	config.SetNamespace("payments")
+	config.SetAs("auditor")
+
+	clusters, err := connectClusters(config, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	cluster := clusters[0]
+	if cluster.Name != "west-admin" || cluster.RestConfig.Host != "https://west.example.com:6443" {
+		t.Errorf("Unexpected cluster %s on %s", cluster.Name, cluster.RestConfig.Host)
+	}
+	if cluster.Namespace != "payments" || cluster.RestConfig.Impersonate.UserName != "auditor" {
+		t.Errorf("Unexpected namespace %s and impersonated user %s", cluster.Namespace, cluster.RestConfig.Impersonate.UserName)
+	}
+
+	// The impersonated user of the kubeconfig is kept when none is configured
+	config.SetAs("")
+	config.SetKubeconfig(writeKubeconfig(t, "impersonating", strings.Replace(testKubeconfig, "    token: secret\n", "    token: secret\n    as: viewer\n", 1)))
+	clusters, err = connectClusters(config, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if clusters[0].RestConfig.Impersonate.UserName != "viewer" {
+		t.Errorf("Expected the impersonated user viewer of the kubeconfig, got %s", clusters[0].RestConfig.Impersonate.UserName)
+	}
+}
+
+func TestConnectKubeconfigPaths(t *testing.T) {
+	contexts := writeKubeconfig(t, "contexts", `apiVersion: v1
+kind: Config
+contexts:
+- name: east-admin
+  context:
+    cluster: east
+    user: admin
+current-context: east-admin
+`)
+	clusters := writeKubeconfig(t, "clusters", `apiVersion: v1
+kind: Config
+clusters:
+- name: east
+  cluster:
+    server: https://east.example.com:6443
+users:
+- name: admin
+  user:
+    token: secret
+`)
+	t.Setenv("KUBECONFIG", contexts+string(os.PathListSeparator)+clusters)
+
+	connected, err := connectClusters(&config.Config{}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if connected[0].Name != "east-admin" || connected[0].RestConfig.Host != "https://east.example.com:6443" {
+		t.Errorf("Unexpected cluster %s on %s", connected[0].Name, connected[0].RestConfig.Host)
+	}
+}
+
+func TestBuildManyClusters(t *testing.T) {
+	topology := model.NewTopologyModel()
+	wg := new(sync.WaitGroup)
+	for _, cluster := range []string{"east", "west"} {
+		builder := newFakeBuilder(objectsOf(
+			deploymentObjects("ns-0", "api", "quay.io/test/api:1.0", 1),
+			deploymentObjects("ns-1", "api", "quay.io/test/api:1.0", 1),
+		)...)
+		builder.topologyModel = topology
+		builder.cluster = cluster
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := builder.build(context.Background()); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if namespaces := topology.AllNamespaces(); len(namespaces) != 4 {
+		t.Errorf("Expected 4 namespaces, got %d", len(namespaces))
+	}
+	for _, cluster := range []string{"east", "west"} {
+		namespace := topology.ClusterNamespaceByName(cluster, "ns-0")
+		if namespace == nil || namespace.Cluster() != cluster {
+			t.Fatalf("Missing namespace ns-0 of cluster %s", cluster)
+		}
+		if deployment := namespace.LookupByKindAndName("Deployment", "api"); deployment == nil {
+			t.Errorf("Missing Deployment api in cluster %s", cluster)
+		}
+	}
+}
+
+// fakeAPIServer serves a Kubernetes cluster with the single empty namespace ns-0, failing the lists of the given resource
+func fakeAPIServer(t *testing.T, failingResource string) *httptest.Server {
+	lists := map[string]string{
+		"/api/v1/namespaces":                             `{"apiVersion":"v1","kind":"NamespaceList","items":[{"metadata":{"name":"ns-0"}}]}`,
+		"/api/v1/namespaces/ns-0/pods":                   `{"apiVersion":"v1","kind":"PodList","items":[]}`,
+		"/api/v1/namespaces/ns-0/replicationcontrollers": `{"apiVersion":"v1","kind":"ReplicationControllerList","items":[]}`,
+		"/apis/apps/v1/namespaces/ns-0/deployments":      `{"apiVersion":"apps/v1","kind":"DeploymentList","items":[]}`,
+		"/apis/apps/v1/namespaces/ns-0/statefulsets":     `{"apiVersion":"apps/v1","kind":"StatefulSetList","items":[]}`,
+		"/apis/apps/v1/namespaces/ns-0/daemonsets":       `{"apiVersion":"apps/v1","kind":"DaemonSetList","items":[]}`,
+		"/apis/apps/v1/namespaces/ns-0/replicasets":      `{"apiVersion":"apps/v1","kind":"ReplicaSetList","items":[]}`,
+		"/apis/batch/v1/namespaces/ns-0/jobs":            `{"apiVersion":"batch/v1","kind":"JobList","items":[]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, ok := lists[req.URL.Path]
+		if !ok {
+			http.NotFound(rw, req)
+			return
+		}
+		if failingResource != "" && strings.HasSuffix(req.URL.Path, "/"+failingResource) {
+			http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCollectClustersSkipsFailedClusters(t *testing.T) {
+	clusters := []*Cluster{
+		{Name: "east", RestConfig: &rest.Config{Host: fakeAPIServer(t, "").URL}},
+		{Name: "west", RestConfig: &rest.Config{Host: fakeAPIServer(t, "deployments").URL}},
+	}
+	topology, err := CollectClusters(context.Background(), &config.Config{}, config.NewRunnerConfig(), clusters)
+	if topology == nil {
+		t.Fatalf("Expected the model of the collected cluster, got error %s", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "cannot collect cluster west") {
+		t.Errorf("Expected error for cluster west, got %v", err)
+	}
+	if namespaces := topology.AllNamespaces(); len(namespaces) != 1 || namespaces[0].Cluster() != "east" {
+		t.Errorf("Expected only the namespace of cluster east, got %d namespaces", len(namespaces))
+	}
+
+	if topology, err = CollectClusters(context.Background(), &config.Config{}, config.NewRunnerConfig(), clusters[1:]); topology != nil || err == nil {
+		t.Errorf("Expected error and no model when the only cluster fails")
+	}
+}
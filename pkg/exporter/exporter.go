@@ -1,12 +1,15 @@
 package exporter
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/dmartinol/application-exporter/pkg/config"
 	logger "github.com/dmartinol/application-exporter/pkg/log"
 	"github.com/dmartinol/application-exporter/pkg/model"
-	"k8s.io/client-go/rest"
 )
 
 type Exporter interface {
@@ -14,27 +17,76 @@ type Exporter interface {
 }
 
 type ExporterRunner interface {
-	Connect() (*rest.Config, error)
-	Collect(runnerConfig *config.RunnerConfig, config *rest.Config) (*model.TopologyModel, error)
+	Connect(runnerConfig *config.RunnerConfig) ([]*Cluster, error)
+	Collect(ctx context.Context, runnerConfig *config.RunnerConfig, clusters []*Cluster) (*model.TopologyModel, error)
 	Transform(topology *model.TopologyModel) *strings.Builder
 	Report(runnerConfig *config.RunnerConfig, output *strings.Builder)
 }
 
-func RunExporter(runner ExporterRunner, runnerConfig *config.RunnerConfig) error {
-	kubeConfig, err := runner.Connect()
-	if err != nil {
+// RunExporter reports the clusters which are successfully connected and collected, skipping the failed ones unless all
+// of them fail
+func RunExporter(ctx context.Context, runner ExporterRunner, runnerConfig *config.RunnerConfig) error {
+	clusters, err := runner.Connect(runnerConfig)
+	if len(clusters) == 0 {
 		logger.Fatalf("Cannot connect cluster: %s", err)
 		return err
 	}
-
-	logger.Info("Cluster connected")
-	topology, err := runner.Collect(runnerConfig, kubeConfig)
 	if err != nil {
+		logger.Warnf("Skipping the clusters which cannot be connected: %s", err)
+	}
+
+	logger.Infof("%d cluster(s) connected", len(clusters))
+	topology, err := runner.Collect(ctx, runnerConfig, clusters)
+	if topology == nil {
 		return err
 	}
+	if err != nil {
+		logger.Warnf("Skipping the clusters which cannot be collected: %s", err)
+	}
 
 	output := runner.Transform(topology)
 	runner.Report(runnerConfig, output)
 
 	return nil
 }
+
+// CollectClusters collects the given clusters in parallel into the same TopologyModel. The clusters which cannot be
+// collected are removed from the model: their errors are returned together with the model of the other clusters, which
+// is nil only when none of the clusters can be collected
+func CollectClusters(ctx context.Context, config *config.Config, runnerConfig *config.RunnerConfig, clusters []*Cluster) (*model.TopologyModel, error) {
+	topology := model.NewTopologyModel()
+	wg := new(sync.WaitGroup)
+	clusterErr := make(chan error, len(clusters))
+	registryClient := newRegistryClient(config)
+	imageCache := sharedImageStreamImageCache(config)
+	imageCache.expire(config.ImageCacheTTL())
+	for _, cluster := range clusters {
+		wg.Add(1)
+		go func(cluster *Cluster) {
+			defer wg.Done()
+			builder := NewModelBuilder(config, runnerConfig)
+			builder.topologyModel = topology
+			builder.registryClient = registryClient
+			builder.imageCache = imageCache
+			builder.cluster = cluster.Name
+			builder.currentNamespace = cluster.Namespace
+			if _, err := builder.BuildForKubeConfig(ctx, cluster.RestConfig); err != nil {
+				logger.Warnf("Cannot collect cluster %s: %s", cluster.Name, err)
+				topology.RemoveCluster(cluster.Name)
+				clusterErr <- fmt.Errorf("cannot collect cluster %s: %w", cluster.Name, err)
+			}
+		}(cluster)
+	}
+	wg.Wait()
+	imageCache.logStats()
+	imageCache.save()
+	close(clusterErr)
+	var errs []error
+	for err := range clusterErr {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 && len(errs) == len(clusters) {
+		return nil, errors.Join(errs...)
+	}
+	return topology, errors.Join(errs...)
+}
@@ -1,9 +1,7 @@
 package exporter
 
 import (
-	"flag"
-	"os"
-	"path/filepath"
+	"context"
 	"strings"
 
 	"github.com/dmartinol/application-exporter/pkg/config"
@@ -11,9 +9,6 @@ import (
 	"github.com/dmartinol/application-exporter/pkg/formatter"
 	logger "github.com/dmartinol/application-exporter/pkg/log"
 	"github.com/dmartinol/application-exporter/pkg/model"
-
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 type ExporterApp struct {
@@ -27,7 +22,7 @@ func NewExporterApp(config *cfg.Config) *ExporterApp {
 
 func (app *ExporterApp) Start() {
 	runner := app.newRunner()
-	RunExporter(runner, app.runnerConfig)
+	RunExporter(context.Background(), runner, app.runnerConfig)
 }
 
 type ExporterAppRunner struct {
@@ -41,18 +36,16 @@ func (app *ExporterApp) newRunner() ExporterAppRunner {
 	return runner
 }
 
-func (r ExporterAppRunner) Connect() (*rest.Config, error) {
-	//Load config for Openshift's go-client from kubeconfig file
-	return clientcmd.BuildConfigFromFlags("", *r.initKubeconfig())
+func (r ExporterAppRunner) Connect(runnerConfig *cfg.RunnerConfig) ([]*Cluster, error) {
+	return connectClusters(r.config, runnerConfig.Clusters())
 }
 
-func (r ExporterAppRunner) Collect(runnerConfig *cfg.RunnerConfig, kubeConfig *rest.Config) (*model.TopologyModel, error) {
-	topology, err := NewModelBuilder(r.config, runnerConfig).BuildForKubeConfig(kubeConfig)
-	if err != nil {
-		logger.Fatalf("Cannot build data model", err)
-		return nil, err
+func (r ExporterAppRunner) Collect(ctx context.Context, runnerConfig *cfg.RunnerConfig, clusters []*Cluster) (*model.TopologyModel, error) {
+	topology, err := CollectClusters(ctx, r.config, runnerConfig, clusters)
+	if topology == nil {
+		logger.Fatalf("Cannot build data model: %s", err)
 	}
-	return topology, nil
+	return topology, err
 }
 
 func (r ExporterAppRunner) Transform(topology *model.TopologyModel) *strings.Builder {
@@ -64,18 +57,3 @@ func (r ExporterAppRunner) Report(runnerConfig *cfg.RunnerConfig, output *string
 	reporter := NewFileReporter(r.config, runnerConfig)
 	reporter.Report(output)
 }
-
-func (r ExporterAppRunner) initKubeconfig() *string {
-	if home := r.homeDir(); home != "" {
-		return flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "")
-	} else {
-		return flag.String("kubeconfig", "", "")
-	}
-}
-
-func (r ExporterAppRunner) homeDir() string {
-	if h := os.Getenv("HOME"); h != "" {
-		return h
-	}
-	return os.Getenv("USERPROFILE") // windows
-}
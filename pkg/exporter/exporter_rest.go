@@ -1,13 +1,13 @@
 package exporter
 
 import (
-	"flag"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dmartinol/application-exporter/pkg/config"
 	cfg "github.com/dmartinol/application-exporter/pkg/config"
@@ -16,11 +16,8 @@ import (
 	"github.com/dmartinol/application-exporter/pkg/model"
 
 	"github.com/gorilla/mux"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
-var kubeconfig *string
 var router = mux.NewRouter()
 
 type ExporterService struct {
@@ -74,10 +71,58 @@ func (s *ExporterService) inventoryHandler(rw http.ResponseWriter, req *http.Req
 	if namespaceSelector != "" {
 		newRunnerConfig.SetNamespaceSelector(namespaceSelector)
 	}
+	clusters := req.FormValue("clusters")
+	if clusters != "" {
+		newRunnerConfig.SetClusters(clusters)
+	}
+	namespaces := req.FormValue("namespaces")
+	if namespaces != "" {
+		newRunnerConfig.SetNamespaces(namespaces)
+	}
+	namespaceIncludes := req.FormValue("ns-include")
+	if namespaceIncludes != "" {
+		if err := newRunnerConfig.SetNamespaceIncludes(namespaceIncludes); err != nil {
+			http.Error(rw, fmt.Sprintf("Invalid ns-include value %s: %s", namespaceIncludes, err), http.StatusBadRequest)
+			return
+		}
+	}
+	namespaceExcludes := req.FormValue("ns-exclude")
+	if namespaceExcludes != "" {
+		if err := newRunnerConfig.SetNamespaceExcludes(namespaceExcludes); err != nil {
+			http.Error(rw, fmt.Sprintf("Invalid ns-exclude value %s: %s", namespaceExcludes, err), http.StatusBadRequest)
+			return
+		}
+	}
+	namespaceAnnotations := req.FormValue("ns-annotations")
+	if namespaceAnnotations != "" {
+		if err := newRunnerConfig.SetNamespaceAnnotations(namespaceAnnotations); err != nil {
+			http.Error(rw, fmt.Sprintf("Invalid ns-annotations value %s: %s", namespaceAnnotations, err), http.StatusBadRequest)
+			return
+		}
+	}
+	workloadSelector := req.FormValue("workload-selector")
+	if workloadSelector != "" {
+		if err := newRunnerConfig.SetWorkloadSelector(workloadSelector); err != nil {
+			http.Error(rw, fmt.Sprintf("Invalid workload-selector value %s: %s", workloadSelector, err), http.StatusBadRequest)
+			return
+		}
+	}
+	kinds := req.FormValue("kinds")
+	if kinds != "" {
+		newRunnerConfig.SetKinds(kinds)
+		if err := newRunnerConfig.ValidateKinds(newConfig.CustomKinds()); err != nil {
+			http.Error(rw, fmt.Sprintf("Invalid kinds value %s: %s", kinds, err), http.StatusBadRequest)
+			return
+		}
+	}
 	outputFileName := req.FormValue("output")
 	if outputFileName != "" {
 		newRunnerConfig.SetOutputFileName(outputFileName)
 	}
+	containerRoles := req.FormValue("container-roles")
+	if containerRoles != "" {
+		newConfig.SetContainerRoles(containerRoles)
+	}
 	withResources := req.FormValue("with-resources")
 	if withResources != "" {
 		newConfig.SetWithResources(true)
@@ -91,11 +136,20 @@ func (s *ExporterService) inventoryHandler(rw http.ResponseWriter, req *http.Req
 			newConfig.SetBurst(burst)
 		}
 	}
+	timeoutArg := req.FormValue("timeout")
+	if timeoutArg != "" {
+		timeout, err := time.ParseDuration(timeoutArg)
+		if err != nil {
+			logger.Warnf("Disregarding non duration value %s", timeoutArg)
+		} else {
+			newConfig.SetTimeout(timeout)
+		}
+	}
 
 	if req.URL.Path == "/inventory" {
 		if req.Method == "POST" {
 			runner := s.NewRunner(&newConfig, rw, req)
-			RunExporter(runner, &newRunnerConfig)
+			RunExporter(req.Context(), runner, &newRunnerConfig)
 		} else {
 			http.Error(rw, fmt.Sprintf("Expect method POST at /, got %v", req.Method), http.StatusMethodNotAllowed)
 		}
@@ -105,21 +159,26 @@ func (s *ExporterService) inventoryHandler(rw http.ResponseWriter, req *http.Req
 	}
 }
 
-func (r ExporterServiceRunner) Connect() (*rest.Config, error) {
-	kubeConfig, err := r.connectCluster()
-	if err != nil {
-		http.Error(r.rw, fmt.Sprintf("Cannot connect cluster: %s", err), http.StatusInternalServerError)
+func (r ExporterServiceRunner) Connect(runnerConfig *cfg.RunnerConfig) ([]*Cluster, error) {
+	clusters, err := connectClusters(r.config, runnerConfig.Clusters())
+	if len(clusters) == 0 {
+		r.httpError(fmt.Sprintf("Cannot connect cluster: %s", err), http.StatusInternalServerError)
 	}
-	return kubeConfig, err
+	return clusters, err
 }
 
-func (r ExporterServiceRunner) Collect(runnerConfig *cfg.RunnerConfig, kubeConfig *rest.Config) (*model.TopologyModel, error) {
-	topology, err := NewModelBuilder(r.config, runnerConfig).BuildForKubeConfig(kubeConfig)
-	if err != nil {
-		http.Error(r.rw, fmt.Sprintf("Cannot build data model: %s", err), http.StatusInternalServerError)
-		return nil, err
+func (r ExporterServiceRunner) Collect(ctx context.Context, runnerConfig *cfg.RunnerConfig, clusters []*Cluster) (*model.TopologyModel, error) {
+	topology, err := CollectClusters(ctx, r.config, runnerConfig, clusters)
+	if topology == nil {
+		if errors.Is(err, context.Canceled) {
+			logger.Warnf("Request canceled by the client: %s", err)
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			r.httpError(fmt.Sprintf("Cannot build data model: %s", err), http.StatusGatewayTimeout)
+		} else {
+			r.httpError(fmt.Sprintf("Cannot build data model: %s", err), http.StatusInternalServerError)
+		}
 	}
-	return topology, nil
+	return topology, err
 }
 
 func (r ExporterServiceRunner) Transform(topology *model.TopologyModel) *strings.Builder {
@@ -132,29 +191,9 @@ func (r ExporterServiceRunner) Report(runnerConfig *cfg.RunnerConfig, output *st
 	reporter.Report(output)
 }
 
-func (s ExporterServiceRunner) initKubeconfig() *string {
-	if home := s.homeDir(); home != "" {
-		return flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "")
-	} else {
-		return flag.String("kubeconfig", "", "")
-	}
-}
-
-func (s ExporterServiceRunner) connectCluster() (*rest.Config, error) {
-	if s.config.RunInContainer() {
-		return rest.InClusterConfig()
-	} else {
-		if kubeconfig == nil {
-			kubeconfig = s.initKubeconfig()
-		}
-		//Load config for Openshift's go-client from kubeconfig file
-		return clientcmd.BuildConfigFromFlags("", *kubeconfig)
-	}
-}
-
-func (s ExporterServiceRunner) homeDir() string {
-	if h := os.Getenv("HOME"); h != "" {
-		return h
+// httpError is a no-op when the runner is not bound to any HTTP response, e.g. from the monitoring exporter
+func (r ExporterServiceRunner) httpError(error string, code int) {
+	if r.rw != nil {
+		http.Error(r.rw, error, code)
 	}
-	return os.Getenv("USERPROFILE") // windows
 }
@@ -0,0 +1,29 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dmartinol/application-exporter/pkg/config"
+)
+
+func TestInventoryHandlerRejectsInvalidParameters(t *testing.T) {
+	service := &ExporterService{config: &config.Config{}, runnerConfig: config.NewRunnerConfig()}
+	for parameter, value := range map[string]string{
+		"ns-include":        "/[a-z/",
+		"ns-exclude":        "/(ns/",
+		"ns-annotations":    "owner in (billing",
+		"workload-selector": "app in billing",
+		"kinds":             "Deployment,Deploymnet",
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/inventory?"+url.Values{parameter: {value}}.Encode(), nil)
+		rw := httptest.NewRecorder()
+		service.inventoryHandler(rw, req)
+		if rw.Code != http.StatusBadRequest || !strings.Contains(rw.Body.String(), parameter) {
+			t.Errorf("Expected status %d for %s=%s, got %d: %s", http.StatusBadRequest, parameter, value, rw.Code, rw.Body.String())
+		}
+	}
+}
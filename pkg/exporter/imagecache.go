@@ -0,0 +1,154 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	cfg "github.com/dmartinol/application-exporter/pkg/config"
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	imageV1 "github.com/openshift/api/image/v1"
+)
+
+var (
+	sharedImageCache     *imageCache
+	sharedImageCacheOnce sync.Once
+)
+
+// cachedImage is an Image found with an ImageStreamImage lookup, and the time of the lookup
+type cachedImage struct {
+	Fetched time.Time     `json:"fetched"`
+	Image   imageV1.Image `json:"image"`
+}
+
+// imageCache stores the Images found with the ImageStreamImage lookups by cluster and digest: the Images are cluster
+// scoped and named after their digest, so the same Image is returned in every namespace. The ImageStreamImages which
+// are not found are stored by cluster, namespace and name instead, and never persisted
+type imageCache struct {
+	mutex    sync.Mutex
+	fileName string
+	images   map[string]cachedImage
+	missing  map[string]time.Time
+
+	hits   int
+	misses int
+}
+
+// sharedImageStreamImageCache returns the cache shared by all the collections, like those of the REST requests and of
+// the Prometheus scrapes, loading the configured cache file at the first invocation
+func sharedImageStreamImageCache(config *cfg.Config) *imageCache {
+	sharedImageCacheOnce.Do(func() {
+		sharedImageCache = newImageCache(config.ImageCacheFile())
+	})
+	return sharedImageCache
+}
+
+// newImageCache returns a cache persisted in the given file, or only in memory if empty
+func newImageCache(fileName string) *imageCache {
+	cache := &imageCache{fileName: fileName, images: make(map[string]cachedImage), missing: make(map[string]time.Time)}
+	if fileName == "" {
+		return cache
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warnf("Cannot read the image cache file %s: %s", fileName, err)
+		}
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache.images); err != nil {
+		logger.Warnf("Disregarding invalid image cache file %s: %s", fileName, err)
+		cache.images = make(map[string]cachedImage)
+	}
+	logger.Infof("Loaded %d images from the image cache file %s", len(cache.images), fileName)
+	return cache
+}
+
+func (c *imageCache) image(cluster string, digest string) (imageV1.Image, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cached, ok := c.images[cluster+"/"+digest]
+	if ok {
+		c.hits++
+	}
+	return cached.Image, ok
+}
+
+func (c *imageCache) addImage(cluster string, digest string, image imageV1.Image) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.images[cluster+"/"+digest] = cachedImage{Fetched: time.Now(), Image: image}
+}
+
+// isMissing returns true if the given ImageStreamImage was not found by a previous lookup
+func (c *imageCache) isMissing(cluster string, namespace string, name string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, ok := c.missing[cluster+"/"+namespace+"/"+name]
+	if ok {
+		c.hits++
+	}
+	return ok
+}
+
+func (c *imageCache) addMissing(cluster string, namespace string, name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.missing[cluster+"/"+namespace+"/"+name] = time.Now()
+}
+
+// addMiss counts a lookup of an ImageStreamImage which is not cached, whether it succeeds or not
+func (c *imageCache) addMiss() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.misses++
+}
+
+// expire removes the entries older than the given time to live, e.g. all those of the previous collections when zero.
+// The Images loaded from the cache file expire after the same time since they were fetched by a previous execution
+func (c *imageCache) expire(ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	expiredAt := time.Now().Add(-ttl)
+	for key, cached := range c.images {
+		if cached.Fetched.Before(expiredAt) {
+			delete(c.images, key)
+		}
+	}
+	for key, fetched := range c.missing {
+		if fetched.Before(expiredAt) {
+			delete(c.missing, key)
+		}
+	}
+}
+
+// logStats logs the hits and misses since the previous invocation, and resets them
+func (c *imageCache) logStats() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	logger.Infof("ImageStreamImage cache: %d hits, %d misses, %d images, %d missing", c.hits, c.misses, len(c.images), len(c.missing))
+	c.hits = 0
+	c.misses = 0
+}
+
+// save writes the found Images to the cache file, if any
+func (c *imageCache) save() {
+	if c.fileName == "" {
+		return
+	}
+	c.mutex.Lock()
+	data, err := json.Marshal(c.images)
+	c.mutex.Unlock()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(c.fileName), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(c.fileName, data, 0o644)
+	}
+	if err != nil {
+		logger.Warnf("Cannot write the image cache file %s: %s", c.fileName, err)
+	}
+}
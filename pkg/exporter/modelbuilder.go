@@ -2,34 +2,81 @@ package exporter
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/dmartinol/application-exporter/pkg/config"
 	logger "github.com/dmartinol/application-exporter/pkg/log"
 	model "github.com/dmartinol/application-exporter/pkg/model"
+	"github.com/dmartinol/application-exporter/pkg/registry"
+	imageV1 "github.com/openshift/api/image/v1"
 	clientAppsV1 "github.com/openshift/client-go/apps/clientset/versioned/typed/apps/v1"
+	clientBuildsV1 "github.com/openshift/client-go/build/clientset/versioned/typed/build/v1"
 	clientImagesV1 "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
-	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sBatchV1 "k8s.io/api/batch/v1"
+	k8sBatchV1beta1 "k8s.io/api/batch/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	k8sClientAppsV1 "k8s.io/client-go/kubernetes/typed/apps/v1"
 	k8sClientBatchV1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	k8sClientBatchV1beta1 "k8s.io/client-go/kubernetes/typed/batch/v1beta1"
 	k8sClientCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/restmapper"
 	k8sClientMetrics "k8s.io/metrics/pkg/client/clientset/versioned"
 
 	"k8s.io/client-go/rest"
 )
 
+var (
+	knativeServicesResource       = schema.GroupVersionResource{Group: "serving.knative.dev", Version: "v1", Resource: "services"}
+	knativeConfigurationsResource = schema.GroupVersionResource{Group: "serving.knative.dev", Version: "v1", Resource: "configurations"}
+	knativeRevisionsResource      = schema.GroupVersionResource{Group: "serving.knative.dev", Version: "v1", Resource: "revisions"}
+)
+
 type ModelBuilder struct {
 	config       *config.Config
 	runnerConfig *config.RunnerConfig
 
-	clientAppsV1       *clientAppsV1.AppsV1Client
-	clientImagesV1     *clientImagesV1.ImageV1Client
-	k8sAppsClientV1    *k8sClientAppsV1.AppsV1Client
-	k8sBatchClientV1   *k8sClientBatchV1.BatchV1Client
-	k8sCoreClientV1    *k8sClientCoreV1.CoreV1Client
-	k8sMetricsClientV1 *k8sClientMetrics.Clientset
+	clientAppsV1          clientAppsV1.AppsV1Interface
+	clientImagesV1        clientImagesV1.ImageV1Interface
+	clientBuildsV1        clientBuildsV1.BuildV1Interface
+	k8sAppsClientV1       k8sClientAppsV1.AppsV1Interface
+	k8sBatchClientV1      k8sClientBatchV1.BatchV1Interface
+	k8sBatchClientV1beta1 k8sClientBatchV1beta1.BatchV1beta1Interface
+	k8sCoreClientV1       k8sClientCoreV1.CoreV1Interface
+	k8sMetricsClientV1    k8sClientMetrics.Interface
+	dynamicClient         dynamic.Interface
+	discoveryClient       discovery.DiscoveryInterface
+	restMapper            meta.RESTMapper
+	restMapperOnce        sync.Once
+
+	customWorkloadKinds map[*config.CustomKind]*model.CustomWorkloadKind
+
+	// Available APIs, as detected by the discovery client
+	withDeploymentConfigs bool
+	withImageStreams      bool
+	withBuilds            bool
+	withKnative           bool
+	cronJobsVersion       string
+
+	// Name of the collected cluster, and namespace of the current context, collected when the namespaces cannot be listed
+	cluster          string
+	currentNamespace string
+
+	// Client of the image registries, if the registry lookup is enabled, and the pull credentials by service account
+	registryClient       *registry.Client
+	pullCredentialsCache map[string]registry.Credentials
+	pullCredentialsMutex sync.Mutex
+
+	// Images of the ImageStreamImage lookups, possibly shared with other builders and collections
+	imageCache *imageCache
 
 	topologyModel *model.TopologyModel
 }
@@ -37,12 +84,30 @@ type ModelBuilder struct {
 func NewModelBuilder(config *config.Config, runnerConfig *config.RunnerConfig) *ModelBuilder {
 	builder := ModelBuilder{config: config, runnerConfig: runnerConfig}
 	builder.topologyModel = model.NewTopologyModel()
+	builder.pullCredentialsCache = make(map[string]registry.Credentials)
+	builder.imageCache = newImageCache("")
+	builder.initCustomWorkloadKinds()
 	return &builder
 }
 
-func (builder *ModelBuilder) BuildForKubeConfig(config *rest.Config) (*model.TopologyModel, error) {
+func (builder *ModelBuilder) initCustomWorkloadKinds() {
+	builder.customWorkloadKinds = make(map[*config.CustomKind]*model.CustomWorkloadKind)
+	for _, customKind := range builder.config.CustomKinds() {
+		workloadKind, err := model.NewCustomWorkloadKind(customKind.PodTemplatePath(), customKind.ContainersPath())
+		if err != nil {
+			logger.Warnf("Skipping custom kind %s: %s", customKind, err)
+			continue
+		}
+		builder.customWorkloadKinds[customKind] = workloadKind
+	}
+}
+
+// BuildForKubeConfig collects the data model until the given context is done or the configured timeout expires,
+// whichever comes first. Namespaces are collected concurrently into the same TopologyModel
+func (builder *ModelBuilder) BuildForKubeConfig(ctx context.Context, config *rest.Config) (*model.TopologyModel, error) {
 	var err error
 	config.Burst = builder.config.Burst()
+	config.Timeout = builder.config.RequestTimeout()
 
 	builder.clientAppsV1, err = clientAppsV1.NewForConfig(config)
 	if err != nil {
@@ -52,6 +117,10 @@ func (builder *ModelBuilder) BuildForKubeConfig(config *rest.Config) (*model.Top
 	if err != nil {
 		return nil, err
 	}
+	builder.clientBuildsV1, err = clientBuildsV1.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
 	builder.k8sAppsClientV1, err = k8sClientAppsV1.NewForConfig(config)
 	if err != nil {
 		return nil, err
@@ -60,6 +129,10 @@ func (builder *ModelBuilder) BuildForKubeConfig(config *rest.Config) (*model.Top
 	if err != nil {
 		return nil, err
 	}
+	builder.k8sBatchClientV1beta1, err = k8sClientBatchV1beta1.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
 	builder.k8sCoreClientV1, err = k8sClientCoreV1.NewForConfig(config)
 	if err != nil {
 		return nil, err
@@ -68,8 +141,26 @@ func (builder *ModelBuilder) BuildForKubeConfig(config *rest.Config) (*model.Top
 	if err != nil {
 		return nil, err
 	}
+	builder.dynamicClient, err = dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	builder.discoveryClient, err = discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return builder.build(ctx)
+}
 
-	err = builder.buildCluster()
+func (builder *ModelBuilder) build(ctx context.Context) (*model.TopologyModel, error) {
+	builder.discoverAPIs()
+	if timeout := builder.config.Timeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := builder.buildCluster(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -77,120 +168,279 @@ func (builder *ModelBuilder) BuildForKubeConfig(config *rest.Config) (*model.Top
 	return builder.topologyModel, nil
 }
 
-func (builder *ModelBuilder) buildCluster() error {
-	logger.Infof("Starting data collection for:\n%s\n%s", builder.config, builder.runnerConfig)
+func (builder *ModelBuilder) buildCluster(ctx context.Context) error {
+	logger.Infof("Starting data collection of cluster %s for:\n%s\n%s", builder.cluster, builder.config, builder.runnerConfig)
 	startAt := time.Now()
-	var namespaces *k8sCoreV1.NamespaceList
-	var err error
-	nsSelector := builder.runnerConfig.NamespaceSelector()
-	logger.Infof("Filtering by %s", nsSelector)
-	namespaces, err = builder.k8sCoreClientV1.Namespaces().List(context.TODO(), k8sMetaV1.ListOptions{LabelSelector: nsSelector})
+	workloadSelector, err := labels.Parse(builder.runnerConfig.WorkloadSelector())
 	if err != nil {
-		logger.Warnf("Cannot list namespaces by selector %s: %s", nsSelector, err)
-		return err
+		return fmt.Errorf("invalid workload selector %s: %w", builder.runnerConfig.WorkloadSelector(), err)
+	}
+	namespaces, err := builder.namespaces(ctx)
+	if err != nil {
+		return builder.interruptedError(ctx, startAt, err)
 	}
 
 	wg := new(sync.WaitGroup)
 
-	nsErr := make(chan error, len(namespaces.Items))
-	for _, namespace := range namespaces.Items {
+	nsErr := make(chan error, len(namespaces))
+	for _, namespace := range namespaces {
 		wg.Add(1)
-		go builder.buildNamespace(wg, namespace.Name, nsErr)
+		go builder.buildNamespace(ctx, wg, namespace, workloadSelector, nsErr)
 	}
 	wg.Wait()
 	close(nsErr)
 	var open bool
 	if err, open = <-nsErr; open {
-		return err
+		return builder.interruptedError(ctx, startAt, err)
 	}
 
 	duration := time.Since(startAt)
-	logger.Infof("Data collection completed in %s (max burst is %d)", duration, builder.config.Burst())
+	logger.Infof("Data collection of cluster %s completed in %s (max burst is %d)", builder.cluster, duration, builder.config.Burst())
 
 	return nil
 }
 
-func (builder *ModelBuilder) buildNamespace(wg *sync.WaitGroup, namespace string, nsErr chan error) {
+// namespaces returns the configured namespaces, if any, otherwise the namespaces matching the configured selector
+// and name and annotation filters.
+// When the namespaces cannot be listed for lack of cluster-scoped permissions, only the current namespace is returned.
+// The namespaces given by name are filtered only by the name filters, since their annotations are not known
+func (builder *ModelBuilder) namespaces(ctx context.Context) ([]string, error) {
+	if namespaces := builder.runnerConfig.Namespaces(); len(namespaces) > 0 {
+		if builder.runnerConfig.NamespaceSelector() != "" {
+			logger.Warnf("Disregarding namespace selector %s for the configured namespaces", builder.runnerConfig.NamespaceSelector())
+		}
+		if builder.runnerConfig.NamespaceAnnotations() != "" {
+			logger.Warnf("Disregarding namespace annotations %s for the configured namespaces", builder.runnerConfig.NamespaceAnnotations())
+		}
+		var matching []string
+		for _, namespace := range namespaces {
+			if !builder.runnerConfig.MatchesNamespaceName(namespace) {
+				logger.Debugf("Skipping filtered namespace %s", namespace)
+				continue
+			}
+			matching = append(matching, namespace)
+		}
+		logger.Infof("Collecting namespaces %v", matching)
+		return matching, nil
+	}
+
+	nsSelector := builder.runnerConfig.NamespaceSelector()
+	logger.Infof("Filtering by %s", nsSelector)
+	namespaceList, err := builder.k8sCoreClientV1.Namespaces().List(ctx, k8sMetaV1.ListOptions{LabelSelector: nsSelector})
+	if err != nil {
+		if k8sErrors.IsForbidden(err) && builder.currentNamespace != "" {
+			if !builder.runnerConfig.MatchesNamespaceName(builder.currentNamespace) {
+				logger.Warnf("Cannot list namespaces, and the current namespace %s is filtered: %s", builder.currentNamespace, err)
+				return nil, nil
+			}
+			logger.Warnf("Cannot list namespaces, collecting only the current namespace %s: %s", builder.currentNamespace, err)
+			return []string{builder.currentNamespace}, nil
+		}
+		logger.Warnf("Cannot list namespaces by selector %s: %s", nsSelector, err)
+		return nil, err
+	}
+	var namespaces []string
+	for _, namespace := range namespaceList.Items {
+		if !builder.runnerConfig.MatchesNamespace(namespace.Name, namespace.Annotations) {
+			logger.Debugf("Skipping filtered namespace %s", namespace.Name)
+			continue
+		}
+		namespaces = append(namespaces, namespace.Name)
+	}
+	return namespaces, nil
+}
+
+// interruptedError replaces the given error with a clear one when the collection was interrupted by the context
+func (builder *ModelBuilder) interruptedError(ctx context.Context, startAt time.Time, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("data collection interrupted after %s: %w", time.Since(startAt).Round(time.Millisecond), ctx.Err())
+	}
+	return err
+}
+
+func (builder *ModelBuilder) buildNamespace(ctx context.Context, wg *sync.WaitGroup, namespace string, workloadSelector labels.Selector, nsErr chan error) {
 	defer wg.Done()
-	namespaceModel := builder.topologyModel.AddNamespace(namespace)
+	// The namespace is added to the model once populated, since the model can be read while being built
+	namespaceModel := model.NewNamespaceModel(builder.cluster, namespace)
+	runnerConfig := builder.runnerConfig
+	listOptions := k8sMetaV1.ListOptions{LabelSelector: runnerConfig.WorkloadSelector()}
 
 	logger.Infof("Running on NS %s", namespace)
-	logger.Debugf("=== %s Deployments ===", namespace)
-	deployments, err := builder.k8sAppsClientV1.Deployments(namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
-	if err != nil {
-		nsErr <- err
-		return
+	if runnerConfig.WithKind("Deployment") {
+		logger.Debugf("=== %s Deployments ===", namespace)
+		deployments, err := builder.k8sAppsClientV1.Deployments(namespace).List(ctx, listOptions)
+		if err != nil {
+			nsErr <- err
+			return
+		}
+		for _, deployment := range deployments.Items {
+			logger.Debugf("Found %s/%s", deployment.Kind, deployment.Name)
+			resource := &model.Deployment{Delegate: deployment}
+			namespaceModel.AddResource(resource)
+			builder.buildApplications(ctx, namespaceModel, resource)
+		}
 	}
-	for _, deployment := range deployments.Items {
-		logger.Debugf("Found %s/%s", deployment.Kind, deployment.Name)
-		resource := &model.Deployment{Delegate: deployment}
-		namespaceModel.AddResource(resource)
-		builder.buildApplications(namespace, resource)
+
+	if runnerConfig.WithKind("StatefulSet") {
+		logger.Debugf("=== %s StatefulSets ===", namespace)
+		statefulSets, err := builder.k8sAppsClientV1.StatefulSets(namespace).List(ctx, listOptions)
+		if err != nil {
+			nsErr <- err
+			return
+		}
+		for _, statefulSet := range statefulSets.Items {
+			logger.Debugf("Found %s/%s", statefulSet.Kind, statefulSet.Name)
+			resource := model.StatefulSet{Delegate: statefulSet}
+			namespaceModel.AddResource(resource)
+			builder.buildApplications(ctx, namespaceModel, resource)
+		}
 	}
 
-	logger.Debugf("=== %s StatefulSets ===", namespace)
-	statefulSets, err := builder.k8sAppsClientV1.StatefulSets(namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
-	if err != nil {
-		nsErr <- err
-		return
+	if builder.withDeploymentConfigs && runnerConfig.WithKind("DeploymentConfig") {
+		logger.Debugf("=== %s DeploymentConfigs ===", namespace)
+		deploymentConfigs, err := builder.clientAppsV1.DeploymentConfigs(namespace).List(ctx, listOptions)
+		if err != nil {
+			nsErr <- err
+			return
+		}
+		for _, deploymentConfig := range deploymentConfigs.Items {
+			logger.Debugf("Found %s/%s", deploymentConfig.Kind, deploymentConfig.Name)
+			resource := &model.DeploymentConfig{Delegate: deploymentConfig}
+			namespaceModel.AddResource(resource)
+			builder.buildApplications(ctx, namespaceModel, resource)
+		}
 	}
-	for _, statefulSet := range statefulSets.Items {
-		logger.Debugf("Found %s/%s", statefulSet.Kind, statefulSet.Name)
-		resource := model.StatefulSet{Delegate: statefulSet}
-		namespaceModel.AddResource(resource)
-		builder.buildApplications(namespace, resource)
+
+	if runnerConfig.WithKind("CronJob") {
+		logger.Debugf("=== %s CronJobs ===", namespace)
+		cronJobs, err := builder.listCronJobs(ctx, namespace, listOptions)
+		if err != nil {
+			nsErr <- err
+			return
+		}
+		for _, cronJob := range cronJobs {
+			logger.Debugf("Found %s/%s", cronJob.Kind, cronJob.Name)
+			resource := &model.CronJob{Delegate: cronJob}
+			namespaceModel.AddResource(resource)
+			builder.buildApplications(ctx, namespaceModel, resource)
+		}
 	}
 
-	logger.Debugf("=== %s DeploymentConfigs ===", namespace)
-	deploymentConfigs, err := builder.clientAppsV1.DeploymentConfigs(namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
-	if err != nil {
-		nsErr <- err
-		return
+	if runnerConfig.WithKind("DaemonSet") {
+		logger.Debugf("=== %s DaemonSets ===", namespace)
+		demonSets, err := builder.k8sAppsClientV1.DaemonSets(namespace).List(ctx, listOptions)
+		if err != nil {
+			nsErr <- err
+			return
+		}
+		for _, demonSet := range demonSets.Items {
+			logger.Debugf("Found %s/%s", demonSet.Kind, demonSet.Name)
+			resource := &model.DaemonSet{Delegate: demonSet}
+			namespaceModel.AddResource(resource)
+			builder.buildApplications(ctx, namespaceModel, resource)
+		}
 	}
-	for _, deploymentConfig := range deploymentConfigs.Items {
-		logger.Debugf("Found %s/%s", deploymentConfig.Kind, deploymentConfig.Name)
-		resource := &model.DeploymentConfig{Delegate: deploymentConfig}
-		namespaceModel.AddResource(resource)
-		builder.buildApplications(namespace, resource)
+
+	if builder.withKnative && runnerConfig.WithKind("KnativeService") {
+		if err := builder.buildKnativeServices(ctx, namespace, namespaceModel, listOptions); err != nil {
+			nsErr <- err
+			return
+		}
 	}
 
-	logger.Debugf("=== %s CronJobs ===", namespace)
-	cronJobs, err := builder.k8sBatchClientV1.CronJobs(namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
-	if err != nil {
-		nsErr <- err
-		return
+	for customKind, workloadKind := range builder.customWorkloadKinds {
+		if !runnerConfig.WithCustomKind(customKind) {
+			continue
+		}
+		if err := builder.buildCustomWorkloads(ctx, namespace, namespaceModel, customKind, workloadKind, listOptions); err != nil {
+			nsErr <- err
+			return
+		}
 	}
-	for _, cronJob := range cronJobs.Items {
-		logger.Debugf("Found %s/%s", cronJob.Kind, cronJob.Name)
-		resource := &model.CronJob{Delegate: cronJob}
-		namespaceModel.AddResource(resource)
-		builder.buildApplications(namespace, resource)
+
+	// The intermediate resources link the pods to the selected workloads, even when their own kind is not selected, and
+	// are reported only as orphans of a selected kind. The Deployments of the Knative Revisions are only intermediates
+	if !runnerConfig.WithKind("Deployment") && builder.withKnative && runnerConfig.WithKind("KnativeService") {
+		logger.Debugf("=== %s Deployments of Knative Revisions ===", namespace)
+		deployments, err := builder.k8sAppsClientV1.Deployments(namespace).List(ctx, k8sMetaV1.ListOptions{})
+		if err != nil {
+			nsErr <- err
+			return
+		}
+		for _, deployment := range deployments.Items {
+			resource := &model.Deployment{Delegate: deployment}
+			if builder.isCollectable(namespaceModel, workloadSelector, resource.Kind(), &deployment.ObjectMeta) {
+				logger.Debugf("Found %s/%s", deployment.Kind, deployment.Name)
+				namespaceModel.AddResource(resource)
+			}
+		}
 	}
 
-	logger.Debugf("=== %s DaemonSets ===", namespace)
-	demonSets, err := builder.k8sAppsClientV1.DaemonSets(namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
+	logger.Debugf("=== %s ReplicaSets ===", namespace)
+	replicaSets, err := builder.k8sAppsClientV1.ReplicaSets(namespace).List(ctx, k8sMetaV1.ListOptions{})
 	if err != nil {
 		nsErr <- err
 		return
 	}
-	for _, demonSet := range demonSets.Items {
-		logger.Debugf("Found %s/%s", demonSet.Kind, demonSet.Name)
-		resource := &model.DaemonSet{Delegate: demonSet}
-		namespaceModel.AddResource(resource)
-		builder.buildApplications(namespace, resource)
+	for _, replicaSet := range replicaSets.Items {
+		logger.Debugf("Found %s/%s", replicaSet.Kind, replicaSet.Name)
+		resource := model.ReplicaSet{Delegate: replicaSet}
+		if builder.isCollectable(namespaceModel, workloadSelector, resource.Kind(), &replicaSet.ObjectMeta) {
+			namespaceModel.AddResource(resource)
+		}
 	}
 
+	if runnerConfig.WithKind("DeploymentConfig") {
+		logger.Debugf("=== %s ReplicationControllers ===", namespace)
+		replicationControllers, err := builder.k8sCoreClientV1.ReplicationControllers(namespace).List(ctx, k8sMetaV1.ListOptions{})
+		if err != nil {
+			nsErr <- err
+			return
+		}
+		for _, replicationController := range replicationControllers.Items {
+			logger.Debugf("Found %s/%s", replicationController.Kind, replicationController.Name)
+			resource := model.ReplicationController{Delegate: replicationController}
+			if builder.isCollectable(namespaceModel, workloadSelector, resource.Kind(), &replicationController.ObjectMeta) {
+				namespaceModel.AddResource(resource)
+			}
+		}
+	}
+
+	if runnerConfig.WithKind("Job") || runnerConfig.WithKind("CronJob") {
+		logger.Debugf("=== %s Jobs ===", namespace)
+		jobs, err := builder.k8sBatchClientV1.Jobs(namespace).List(ctx, k8sMetaV1.ListOptions{})
+		if err != nil {
+			nsErr <- err
+			return
+		}
+		for _, job := range jobs.Items {
+			logger.Debugf("Found %s/%s", job.Kind, job.Name)
+			resource := model.Job{Delegate: job}
+			if builder.isCollectable(namespaceModel, workloadSelector, resource.Kind(), &job.ObjectMeta) {
+				namespaceModel.AddResource(resource)
+			}
+		}
+	}
+
+	// Pods come last, to resolve their owners among the resources collected so far
 	logger.Debugf("=== %s Pods ===", namespace)
-	pods, err := builder.k8sCoreClientV1.Pods(namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
+	pods, err := builder.k8sCoreClientV1.Pods(namespace).List(ctx, k8sMetaV1.ListOptions{})
 	if err != nil {
 		nsErr <- err
 		return
 	}
 	for _, pod := range pods.Items {
 		logger.Debugf("Found %s/%s with SA %s", pod.Kind, pod.Name, pod.Spec.ServiceAccountName)
+		if ctx.Err() != nil {
+			nsErr <- ctx.Err()
+			return
+		}
 		resource := model.Pod{Delegate: pod}
+		if !builder.isCollectable(namespaceModel, workloadSelector, resource.Kind(), &pod.ObjectMeta) {
+			continue
+		}
 		if builder.config.WithResources() && resource.IsRunning() {
-			podMetrics, err := builder.k8sMetricsClientV1.MetricsV1beta1().PodMetricses(namespace).Get(context.TODO(), pod.Name, k8sMetaV1.GetOptions{})
+			podMetrics, err := builder.k8sMetricsClientV1.MetricsV1beta1().PodMetricses(namespace).Get(ctx, pod.Name, k8sMetaV1.GetOptions{})
 			if err != nil {
 				logger.Warnf("No metrics for Pod %s: %s", pod.Name, err)
 			} else {
@@ -200,22 +450,362 @@ func (builder *ModelBuilder) buildNamespace(wg *sync.WaitGroup, namespace string
 		namespaceModel.AddResource(resource)
 	}
 
+	visited := make(map[k8sTypes.UID]bool)
+	for _, applicationProvider := range namespaceModel.AllApplicationProviders() {
+		builder.resolveOwners(ctx, namespace, namespaceModel, applicationProvider.(model.Resource), visited)
+	}
+
+	for _, applicationProvider := range namespaceModel.AllApplicationProviders() {
+		// The intermediate resources, like Jobs and Pods, are reported when not owned by other applications
+		if _, ok := applicationProvider.(model.OrphanProvider); ok {
+			logger.Debugf("Found %s/%s not owned by other applications", applicationProvider.(model.Resource).Kind(), applicationProvider.(model.Resource).Name())
+			builder.buildApplications(ctx, namespaceModel, applicationProvider)
+		}
+		// The ephemeral containers are only known once the pods are collected
+		builder.buildApplicationConfigs(ctx, namespaceModel, namespaceModel.EphemeralConfigsOf(applicationProvider))
+	}
+
+	builder.topologyModel.AddNamespaceModel(namespaceModel)
 	logger.Infof("Completed NS %s", namespace)
 }
 
-func (builder *ModelBuilder) buildApplications(namespace string, applicationProvider model.ApplicationProvider) {
-	for _, appConfig := range applicationProvider.ApplicationConfigs() {
-		logger.Debugf("Loading application %s", appConfig)
-		if appConfig.IsImageStream() {
-			imageStream, err := builder.clientImagesV1.ImageStreamImages(namespace).Get(context.TODO(), appConfig.ImageStreamId(), k8sMetaV1.GetOptions{})
-			if err != nil {
-				logger.Warnf("Cannot load image for %s: %s", appConfig.ImageName, err)
-			} else {
-				logger.Debugf("Found image %s", imageStream.Image.Name)
-				builder.topologyModel.AddImage(appConfig.ImageName, model.NewImageByStream(appConfig.ImageName, imageStream.Image))
+// isCollectable returns true if the given intermediate resource, like a ReplicaSet or a Pod, must be collected. When the
+// workloads are filtered, only the resources owned by the collected ones and the orphans matching the filters are
+// collected
+func (builder *ModelBuilder) isCollectable(namespaceModel *model.NamespaceModel, workloadSelector labels.Selector, kind string, object k8sMetaV1.Object) bool {
+	if !builder.runnerConfig.WithWorkloadFilters() {
+		return true
+	}
+	if len(object.GetOwnerReferences()) > 0 {
+		for _, ref := range object.GetOwnerReferences() {
+			if namespaceModel.LookupOwner(ref) != nil {
+				return true
 			}
+		}
+		return false
+	}
+	return builder.runnerConfig.WithKind(kind) && workloadSelector.Matches(labels.Set(object.GetLabels()))
+}
+
+// listCronJobs lists the CronJobs with the discovered API version, converting the batch/v1beta1 ones to batch/v1
+func (builder *ModelBuilder) listCronJobs(ctx context.Context, namespace string, listOptions k8sMetaV1.ListOptions) ([]k8sBatchV1.CronJob, error) {
+	switch builder.cronJobsVersion {
+	case "v1":
+		cronJobs, err := builder.k8sBatchClientV1.CronJobs(namespace).List(ctx, listOptions)
+		if err != nil {
+			return nil, err
+		}
+		return cronJobs.Items, nil
+	case "v1beta1":
+		cronJobs, err := builder.k8sBatchClientV1beta1.CronJobs(namespace).List(ctx, listOptions)
+		if err != nil {
+			return nil, err
+		}
+		var items []k8sBatchV1.CronJob
+		for _, cronJob := range cronJobs.Items {
+			items = append(items, cronJobFromV1beta1(cronJob))
+		}
+		return items, nil
+	}
+	return nil, nil
+}
+
+func cronJobFromV1beta1(cronJob k8sBatchV1beta1.CronJob) k8sBatchV1.CronJob {
+	return k8sBatchV1.CronJob{
+		TypeMeta:   cronJob.TypeMeta,
+		ObjectMeta: cronJob.ObjectMeta,
+		Spec: k8sBatchV1.CronJobSpec{
+			Schedule: cronJob.Spec.Schedule,
+			TimeZone: cronJob.Spec.TimeZone,
+			Suspend:  cronJob.Spec.Suspend,
+			JobTemplate: k8sBatchV1.JobTemplateSpec{
+				ObjectMeta: cronJob.Spec.JobTemplate.ObjectMeta,
+				Spec:       cronJob.Spec.JobTemplate.Spec,
+			},
+		},
+	}
+}
+
+// buildKnativeServices collects the Knative Services with their Configurations and Revisions, so that the pods of the
+// Revisions are owned by the Services. Nothing is collected when Knative Serving is not installed, or cannot be read
+func (builder *ModelBuilder) buildKnativeServices(ctx context.Context, namespace string, namespaceModel *model.NamespaceModel, listOptions k8sMetaV1.ListOptions) error {
+	logger.Debugf("=== %s Knative Services ===", namespace)
+	services, err := builder.dynamicClient.Resource(knativeServicesResource).Namespace(namespace).List(ctx, listOptions)
+	if err != nil {
+		return skipUnavailable(err, "Knative Services", namespace)
+	}
+	if len(services.Items) == 0 {
+		return nil
+	}
+
+	configurations, err := builder.dynamicClient.Resource(knativeConfigurationsResource).Namespace(namespace).List(ctx, k8sMetaV1.ListOptions{})
+	if err != nil {
+		return skipUnavailable(err, "Knative Configurations", namespace)
+	}
+	for _, configuration := range configurations.Items {
+		logger.Debugf("Found %s/%s", configuration.GetKind(), configuration.GetName())
+		namespaceModel.AddResource(model.UnstructuredResource{Delegate: configuration})
+	}
+
+	revisions, err := builder.dynamicClient.Resource(knativeRevisionsResource).Namespace(namespace).List(ctx, k8sMetaV1.ListOptions{})
+	if err != nil {
+		return skipUnavailable(err, "Knative Revisions", namespace)
+	}
+	revisionsByName := make(map[string]model.KnativeRevision)
+	for _, item := range revisions.Items {
+		logger.Debugf("Found %s/%s", item.GetKind(), item.GetName())
+		revision := model.KnativeRevision{UnstructuredResource: model.UnstructuredResource{Delegate: item}}
+		namespaceModel.AddResource(revision)
+		revisionsByName[revision.Name()] = revision
+	}
+
+	for _, item := range services.Items {
+		logger.Debugf("Found %s/%s", item.GetKind(), item.GetName())
+		resource := model.KnativeService{UnstructuredResource: model.UnstructuredResource{Delegate: item}}
+		if revision, ok := revisionsByName[resource.LatestReadyRevisionName()]; ok {
+			resource.LatestReadyRevision = &revision
+		} else {
+			logger.Warnf("No ready Revision for Knative Service %s in %s", resource.Name(), namespace)
+		}
+		namespaceModel.AddResource(resource)
+		builder.buildApplications(ctx, namespaceModel, resource)
+	}
+	return nil
+}
+
+// buildCustomWorkloads collects the workloads of the given custom kind. Nothing is collected when the kind is not
+// defined in the cluster, or cannot be read
+func (builder *ModelBuilder) buildCustomWorkloads(ctx context.Context, namespace string, namespaceModel *model.NamespaceModel,
+	customKind *config.CustomKind, workloadKind *model.CustomWorkloadKind, listOptions k8sMetaV1.ListOptions) error {
+	logger.Debugf("=== %s %s ===", namespace, customKind)
+	workloads, err := builder.dynamicClient.Resource(customKind.Resource()).Namespace(namespace).List(ctx, listOptions)
+	if err != nil {
+		return skipUnavailable(err, customKind.String(), namespace)
+	}
+	for _, workload := range workloads.Items {
+		logger.Debugf("Found %s/%s", workload.GetKind(), workload.GetName())
+		resource := model.CustomWorkload{UnstructuredResource: model.UnstructuredResource{Delegate: workload}, WorkloadKind: workloadKind}
+		namespaceModel.AddResource(resource)
+		builder.buildApplications(ctx, namespaceModel, resource)
+	}
+	return nil
+}
+
+// skipUnavailable returns nil when the given list error means that the optional resources are not defined in the cluster,
+// or that the exporter is not allowed to read them, so that they are skipped instead of failing the namespace
+func skipUnavailable(err error, resources string, namespace string) error {
+	if k8sErrors.IsNotFound(err) {
+		logger.Debugf("Skipping %s in %s: %s", resources, namespace, err)
+		return nil
+	}
+	if k8sErrors.IsForbidden(err) {
+		logger.Warnf("Skipping %s in %s: %s", resources, namespace, err)
+		return nil
+	}
+	return err
+}
+
+// resolveOwners adds to the namespace the owners of the given resource which were not collected, like operator-managed
+// custom resources, walking up the ownerReferences to the top-most owner
+func (builder *ModelBuilder) resolveOwners(ctx context.Context, namespace string, namespaceModel *model.NamespaceModel,
+	resource model.Resource, visited map[k8sTypes.UID]bool) {
+	for _, ref := range resource.OwnerReferences() {
+		if visited[ref.UID] {
+			continue
+		}
+		visited[ref.UID] = true
+		owner := namespaceModel.LookupOwner(ref)
+		if owner == nil {
+			owner = builder.fetchOwner(ctx, namespace, ref)
+			if owner == nil {
+				continue
+			}
+			namespaceModel.AddResource(owner)
+		}
+		builder.resolveOwners(ctx, namespace, namespaceModel, owner, visited)
+	}
+}
+
+// discoverAPIs detects the optional APIs, like the OpenShift ones which are missing in vanilla Kubernetes, and the
+// supported version of the CronJobs
+func (builder *ModelBuilder) discoverAPIs() {
+	builder.withDeploymentConfigs = builder.hasResource("apps.openshift.io/v1", "deploymentconfigs")
+	builder.withImageStreams = builder.hasResource("image.openshift.io/v1", "imagestreamimages")
+	builder.withBuilds = builder.config.VerifyBuilds() && builder.hasResource("build.openshift.io/v1", "builds")
+	builder.withKnative = builder.hasResource("serving.knative.dev/v1", "services")
+	builder.cronJobsVersion = ""
+	if builder.hasResource("batch/v1", "cronjobs") {
+		builder.cronJobsVersion = "v1"
+	} else if builder.hasResource("batch/v1beta1", "cronjobs") {
+		builder.cronJobsVersion = "v1beta1"
+	}
+	logger.Infof("Discovered APIs: DeploymentConfigs %v, ImageStreams %v, Builds %v, Knative %v, CronJobs version %q",
+		builder.withDeploymentConfigs, builder.withImageStreams, builder.withBuilds, builder.withKnative, builder.cronJobsVersion)
+}
+
+// hasResource returns true if the server serves the given resource, or if the discovery fails for any reason other
+// than the missing group version
+func (builder *ModelBuilder) hasResource(groupVersion string, resource string) bool {
+	resources, err := builder.discoveryClient.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return false
+		}
+		logger.Warnf("Cannot discover resources of %s, assuming %s are available: %s", groupVersion, resource, err)
+		return true
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// getRESTMapper discovers the API resources of the cluster at the first invocation
+func (builder *ModelBuilder) getRESTMapper() meta.RESTMapper {
+	builder.restMapperOnce.Do(func() {
+		groupResources, err := restmapper.GetAPIGroupResources(builder.discoveryClient)
+		if err != nil {
+			logger.Warnf("Cannot discover all the API resources: %s", err)
+		}
+		builder.restMapper = restmapper.NewDiscoveryRESTMapper(groupResources)
+	})
+	return builder.restMapper
+}
+
+func (builder *ModelBuilder) fetchOwner(ctx context.Context, namespace string, ref k8sMetaV1.OwnerReference) model.Resource {
+	groupVersion, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		logger.Warnf("Invalid API version of owner %s %s: %s", ref.Kind, ref.Name, err)
+		return nil
+	}
+	mapping, err := builder.getRESTMapper().RESTMapping(groupVersion.WithKind(ref.Kind).GroupKind(), groupVersion.Version)
+	if err != nil {
+		logger.Debugf("Cannot resolve resource of owner %s %s: %s", ref.Kind, ref.Name, err)
+		return nil
+	}
+
+	var resourceClient dynamic.ResourceInterface = builder.dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		resourceClient = builder.dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+	}
+	owner, err := resourceClient.Get(ctx, ref.Name, k8sMetaV1.GetOptions{})
+	if err != nil {
+		logger.Warnf("Cannot load owner %s %s: %s", ref.Kind, ref.Name, err)
+		return nil
+	}
+	if owner.GetUID() != ref.UID {
+		logger.Debugf("Skipping owner %s %s with mismatching UID %s", ref.Kind, ref.Name, owner.GetUID())
+		return nil
+	}
+	logger.Debugf("Found owner %s/%s", owner.GetKind(), owner.GetName())
+	return model.UnstructuredResource{Delegate: *owner}
+}
+
+// resolveImageTrigger resolves the latest image of the given ImageStreamTag, unless already resolved in the namespace
+func (builder *ModelBuilder) resolveImageTrigger(ctx context.Context, namespaceModel *model.NamespaceModel, trigger model.ImageTrigger) {
+	if _, ok := namespaceModel.LatestImageOf(trigger); ok {
+		return
+	}
+	imageStreamTag, err := builder.clientImagesV1.ImageStreamTags(trigger.Namespace).Get(ctx, trigger.Name, k8sMetaV1.GetOptions{})
+	if err != nil {
+		logger.Warnf("Cannot load ImageStreamTag %s/%s: %s", trigger.Namespace, trigger.Name, err)
+		return
+	}
+	logger.Debugf("Latest image of %s/%s is %s", trigger.Namespace, trigger.Name, imageStreamTag.Image.Name)
+	namespaceModel.AddLatestImage(trigger, imageStreamTag.Image.Name)
+}
+
+// imageStreamImage returns the Image of the ImageStreamImage of the given container, from the cache if it was already
+// found for the same digest, or not found in the same namespace
+func (builder *ModelBuilder) imageStreamImage(ctx context.Context, namespace string, appConfig model.ApplicationConfig) (imageV1.Image, error) {
+	ref, _ := appConfig.ImageReference()
+	if image, ok := builder.imageCache.image(builder.cluster, ref.Digest); ok {
+		return image, nil
+	}
+	if builder.imageCache.isMissing(builder.cluster, namespace, appConfig.ImageStreamId()) {
+		return imageV1.Image{}, fmt.Errorf("ImageStreamImage %s not found in a previous lookup", appConfig.ImageStreamId())
+	}
+	builder.imageCache.addMiss()
+	imageStream, err := builder.clientImagesV1.ImageStreamImages(namespace).Get(ctx, appConfig.ImageStreamId(), k8sMetaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			builder.imageCache.addMissing(builder.cluster, namespace, appConfig.ImageStreamId())
+		}
+		return imageV1.Image{}, err
+	}
+	builder.imageCache.addImage(builder.cluster, ref.Digest, imageStream.Image)
+	return imageStream.Image, nil
+}
+
+func (builder *ModelBuilder) buildApplications(ctx context.Context, namespaceModel *model.NamespaceModel, applicationProvider model.ApplicationProvider) {
+	builder.buildApplicationConfigs(ctx, namespaceModel, applicationProvider.ApplicationConfigs())
+}
+func (builder *ModelBuilder) buildApplicationConfigs(ctx context.Context, namespaceModel *model.NamespaceModel, appConfigs []model.ApplicationConfig) {
+	namespace := namespaceModel.Name()
+	for _, appConfig := range appConfigs {
+		if !builder.config.WithContainerRole(appConfig.Role.String()) {
+			continue
+		}
+		logger.Debugf("Loading application %s", appConfig)
+		if appConfig.ImageTrigger != nil && builder.withImageStreams {
+			builder.resolveImageTrigger(ctx, namespaceModel, *appConfig.ImageTrigger)
+		}
+		applicationImage := builder.loadImage(ctx, namespace, appConfig)
+		builder.topologyModel.AddImage(appConfig.ImageName, applicationImage)
+		if builder.withBuilds {
+			builder.loadBuild(ctx, namespaceModel, model.ImageProvenance(applicationImage, namespace).Build)
+		}
+	}
+}
+
+// loadImage returns the image of the given container, from its ImageStream if pinned by digest, or else from its
+// registry when the registry lookup is enabled
+func (builder *ModelBuilder) loadImage(ctx context.Context, namespace string, appConfig model.ApplicationConfig) model.ApplicationImage {
+	if appConfig.IsImageStream() && builder.withImageStreams {
+		image, err := builder.imageStreamImage(ctx, namespace, appConfig)
+		if err == nil {
+			logger.Debugf("Found image %s", image.Name)
+			return model.NewImageByStream(appConfig.ImageName, image)
+		}
+		// Images pinned by digest are not necessarily in an ImageStream, like those pulled from external registries
+		logger.Warnf("Cannot load image for %s: %s", appConfig.ImageName, err)
+	}
+	image := model.NewImageByRegistry(appConfig.ImageName)
+	if builder.registryClient != nil {
+		builder.fetchImageConfig(ctx, namespace, appConfig, image)
+	}
+	return image
+}
+
+// loadBuild loads the given Build of an image, unless already loaded in the namespace. Pruned Builds are stored as nil
+func (builder *ModelBuilder) loadBuild(ctx context.Context, namespaceModel *model.NamespaceModel, ref model.BuildReference) {
+	if ref.Name == "" {
+		return
+	}
+	if _, ok := namespaceModel.BuildOf(ref); ok {
+		return
+	}
+	build, err := builder.clientBuildsV1.Builds(ref.Namespace).Get(ctx, ref.Name, k8sMetaV1.GetOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			logger.Debugf("Build %s/%s not found", ref.Namespace, ref.Name)
+			namespaceModel.AddBuild(ref, nil)
 		} else {
-			builder.topologyModel.AddImage(appConfig.ImageName, model.NewImageByRegistry(appConfig.ImageName))
+			logger.Warnf("Cannot load Build %s/%s: %s", ref.Namespace, ref.Name, err)
 		}
+		return
+	}
+	modelBuild := &model.Build{}
+	if build.Spec.Source.Git != nil {
+		modelBuild.SourceLocation = build.Spec.Source.Git.URI
+	}
+	if build.Spec.Revision != nil && build.Spec.Revision.Git != nil {
+		modelBuild.CommitId = build.Spec.Revision.Git.Commit
+	}
+	if build.Status.Output.To != nil {
+		modelBuild.ImageDigest = build.Status.Output.To.ImageDigest
 	}
+	namespaceModel.AddBuild(ref, modelBuild)
 }
@@ -0,0 +1,979 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dmartinol/application-exporter/pkg/config"
+	"github.com/dmartinol/application-exporter/pkg/formatter"
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	"github.com/dmartinol/application-exporter/pkg/model"
+	"github.com/dmartinol/application-exporter/pkg/registry"
+	"github.com/magiconair/properties"
+	appsV1 "github.com/openshift/api/apps/v1"
+	buildV1 "github.com/openshift/api/build/v1"
+	imageV1 "github.com/openshift/api/image/v1"
+	appsFake "github.com/openshift/client-go/apps/clientset/versioned/fake"
+	appsFakeV1 "github.com/openshift/client-go/apps/clientset/versioned/typed/apps/v1/fake"
+	buildFake "github.com/openshift/client-go/build/clientset/versioned/fake"
+	imageFake "github.com/openshift/client-go/image/clientset/versioned/fake"
+	imageFakeV1 "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1/fake"
+	k8sAppsV1 "k8s.io/api/apps/v1"
+	k8sBatchV1 "k8s.io/api/batch/v1"
+	k8sBatchV1beta1 "k8s.io/api/batch/v1beta1"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+	discoveryFake "k8s.io/client-go/discovery/fake"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	k8sFake "k8s.io/client-go/kubernetes/fake"
+	k8sAppsFakeV1 "k8s.io/client-go/kubernetes/typed/apps/v1/fake"
+	k8sCoreFakeV1 "k8s.io/client-go/kubernetes/typed/core/v1/fake"
+	k8sTesting "k8s.io/client-go/testing"
+	metricsFake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+const (
+	testDigest  = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	otherDigest = "sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+)
+
+func init() {
+	logger.InitLogger(false, "warn")
+}
+
+func objectMeta(namespace string, name string, owners ...k8sMetaV1.OwnerReference) k8sMetaV1.ObjectMeta {
+	return k8sMetaV1.ObjectMeta{Namespace: namespace, Name: name, UID: k8sTypes.UID(namespace + "/" + name), OwnerReferences: owners}
+}
+
+func podTemplate(image string) k8sCoreV1.PodTemplateSpec {
+	return k8sCoreV1.PodTemplateSpec{Spec: k8sCoreV1.PodSpec{Containers: []k8sCoreV1.Container{{Name: "main", Image: image}}}}
+}
+
+// newFakeBuilder returns a ModelBuilder connected to fake clientsets of an OpenShift cluster holding only the given
+// objects, each one added to the clientset of its API. The namespaces of the objects are created, unless given
+func newFakeBuilder(objects ...runtime.Object) *ModelBuilder {
+	var k8sObjects, appsObjects, imageObjects, buildObjects, dynamicObjects []runtime.Object
+	namespaces := make(map[string]bool)
+	for _, object := range objects {
+		switch object := object.(type) {
+		case *k8sCoreV1.Namespace:
+			namespaces[object.Name] = true
+			k8sObjects = append(k8sObjects, object)
+			continue
+		case *appsV1.DeploymentConfig:
+			appsObjects = append(appsObjects, object)
+		case *imageV1.ImageStreamImage, *imageV1.ImageStreamTag:
+			imageObjects = append(imageObjects, object)
+		case *buildV1.Build:
+			buildObjects = append(buildObjects, object)
+		case *unstructured.Unstructured:
+			dynamicObjects = append(dynamicObjects, object)
+		default:
+			k8sObjects = append(k8sObjects, object)
+		}
+		if metaObject, err := meta.Accessor(object); err == nil && metaObject.GetNamespace() != "" && !namespaces[metaObject.GetNamespace()] {
+			namespaces[metaObject.GetNamespace()] = true
+			k8sObjects = append(k8sObjects, &k8sCoreV1.Namespace{ObjectMeta: k8sMetaV1.ObjectMeta{Name: metaObject.GetNamespace()}})
+		}
+	}
+
+	builder := NewModelBuilder(&config.Config{}, config.NewRunnerConfig())
+	k8sClient := k8sFake.NewSimpleClientset(k8sObjects...)
+	builder.k8sAppsClientV1 = k8sClient.AppsV1()
+	builder.k8sBatchClientV1 = k8sClient.BatchV1()
+	builder.k8sBatchClientV1beta1 = k8sClient.BatchV1beta1()
+	builder.k8sCoreClientV1 = k8sClient.CoreV1()
+	builder.k8sMetricsClientV1 = metricsFake.NewSimpleClientset()
+	builder.discoveryClient = k8sClient.Discovery()
+	builder.discoveryClient.(*discoveryFake.FakeDiscovery).Resources = openShiftAPIResources()
+	builder.clientAppsV1 = appsFake.NewSimpleClientset(appsObjects...).AppsV1()
+	builder.clientImagesV1 = imageFake.NewSimpleClientset(imageObjects...).ImageV1()
+	builder.clientBuildsV1 = buildFake.NewSimpleClientset(buildObjects...).BuildV1()
+	builder.dynamicClient = dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), knativeListKinds, dynamicObjects...)
+	return builder
+}
+
+// openShiftAPIResources returns the discovered resources of an OpenShift cluster
+func openShiftAPIResources() []*k8sMetaV1.APIResourceList {
+	return []*k8sMetaV1.APIResourceList{
+		{GroupVersion: "apps.openshift.io/v1", APIResources: []k8sMetaV1.APIResource{{Name: "deploymentconfigs", Kind: "DeploymentConfig", Namespaced: true}}},
+		{GroupVersion: "image.openshift.io/v1", APIResources: []k8sMetaV1.APIResource{{Name: "imagestreamimages", Kind: "ImageStreamImage", Namespaced: true}}},
+		{GroupVersion: "build.openshift.io/v1", APIResources: []k8sMetaV1.APIResource{{Name: "builds", Kind: "Build", Namespaced: true}}},
+		{GroupVersion: "batch/v1", APIResources: []k8sMetaV1.APIResource{{Name: "jobs", Kind: "Job", Namespaced: true}, {Name: "cronjobs", Kind: "CronJob", Namespaced: true}}},
+		{GroupVersion: "serving.knative.dev/v1", APIResources: []k8sMetaV1.APIResource{{Name: "services", Kind: "Service", Namespaced: true}}},
+	}
+}
+
+var knativeListKinds = map[schema.GroupVersionResource]string{
+	knativeServicesResource:       "ServiceList",
+	knativeConfigurationsResource: "ConfigurationList",
+	knativeRevisionsResource:      "RevisionList",
+}
+
+// customResource returns a custom resource of the given kind, like a Knative Service or an Argo Rollout
+func customResource(namespace string, apiVersion string, kind string, name string, owners ...k8sMetaV1.OwnerReference) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion(apiVersion)
+	object.SetKind(kind)
+	object.SetNamespace(namespace)
+	object.SetName(name)
+	object.SetUID(k8sTypes.UID(namespace + "/" + kind + "/" + name))
+	object.SetOwnerReferences(owners)
+	return object
+}
+
+// deploymentObjects returns a Deployment running the given image, with its ReplicaSet and the given number of running
+// Pods
+func deploymentObjects(namespace string, name string, image string, pods int) []runtime.Object {
+	deployment := &k8sAppsV1.Deployment{ObjectMeta: objectMeta(namespace, name)}
+	deployment.Spec.Template = podTemplate(image)
+	replicaSet := &k8sAppsV1.ReplicaSet{ObjectMeta: objectMeta(namespace, name+"-5d9f8c7b6", model.ControllerReference("Deployment", name, deployment.UID))}
+	objects := []runtime.Object{deployment, replicaSet}
+	for p := 0; p < pods; p++ {
+		pod := &k8sCoreV1.Pod{ObjectMeta: objectMeta(namespace, fmt.Sprintf("%s-%d", replicaSet.Name, p), model.ControllerReference("ReplicaSet", replicaSet.Name, replicaSet.UID))}
+		pod.Status.Phase = k8sCoreV1.PodRunning
+		objects = append(objects, pod)
+	}
+	return objects
+}
+
+// knativeServiceObjects returns a Knative Service with its Configuration and latest ready Revision, running the given
+// image pinned to testDigest in the Deployment of the Revision, with its ReplicaSet and one Pod
+func knativeServiceObjects(namespace string, name string, image string) []runtime.Object {
+	const knativeAPIVersion = "serving.knative.dev/v1"
+	revisionName := name + "-00001"
+	imageDigest := strings.Split(image, ":")[0] + "@" + testDigest
+	service := customResource(namespace, knativeAPIVersion, "Service", name)
+	unstructured.SetNestedField(service.Object, revisionName, "status", "latestReadyRevisionName")
+	configuration := customResource(namespace, knativeAPIVersion, "Configuration", name, model.ControllerReference("Service", name, service.GetUID()))
+	revision := customResource(namespace, knativeAPIVersion, "Revision", revisionName, model.ControllerReference("Configuration", name, configuration.GetUID()))
+	unstructured.SetNestedSlice(revision.Object, []interface{}{map[string]interface{}{"name": "user-container", "image": image}}, "spec", "containers")
+	unstructured.SetNestedSlice(revision.Object, []interface{}{map[string]interface{}{"name": "user-container", "imageDigest": imageDigest}}, "status", "containerStatuses")
+
+	deployment := &k8sAppsV1.Deployment{ObjectMeta: objectMeta(namespace, revisionName+"-deployment", model.ControllerReference("Revision", revisionName, revision.GetUID()))}
+	deployment.Spec.Template = podTemplate(imageDigest)
+	replicaSet := &k8sAppsV1.ReplicaSet{ObjectMeta: objectMeta(namespace, deployment.Name+"-7c9d", model.ControllerReference("Deployment", deployment.Name, deployment.UID))}
+	pod := &k8sCoreV1.Pod{ObjectMeta: objectMeta(namespace, replicaSet.Name+"-x2x", model.ControllerReference("ReplicaSet", replicaSet.Name, replicaSet.UID))}
+	return []runtime.Object{service, configuration, revision, deployment, replicaSet, pod}
+}
+
+// imageStreamObjects returns a DeploymentConfig running the image of an ImageStream by digest, with the
+// ImageStreamImage of the digest
+func imageStreamObjects(namespace string, name string, digest string) []runtime.Object {
+	deploymentConfig := &appsV1.DeploymentConfig{ObjectMeta: objectMeta(namespace, name)}
+	template := podTemplate(fmt.Sprintf("image-registry.openshift-image-registry.svc:5000/%s/%s@%s", namespace, name, digest))
+	deploymentConfig.Spec.Template = &template
+	imageStreamImage := &imageV1.ImageStreamImage{
+		ObjectMeta: k8sMetaV1.ObjectMeta{Namespace: namespace, Name: name + "@" + digest},
+		Image:      imageV1.Image{DockerImageReference: fmt.Sprintf("registry.example.com/%s:1.0@%s", name, digest)},
+	}
+	return []runtime.Object{deploymentConfig, imageStreamImage}
+}
+
+// orphanObjects returns a Job and a Pod without owner
+func orphanObjects(namespace string) []runtime.Object {
+	job := &k8sBatchV1.Job{ObjectMeta: objectMeta(namespace, "migration")}
+	job.Spec.Template = podTemplate("quay.io/test/migration:1.0")
+	pod := &k8sCoreV1.Pod{ObjectMeta: objectMeta(namespace, "debug"), Spec: podTemplate("quay.io/test/debug:1.0").Spec}
+	return []runtime.Object{job, pod}
+}
+
+func objectsOf(objectLists ...[]runtime.Object) []runtime.Object {
+	var objects []runtime.Object
+	for _, objectList := range objectLists {
+		objects = append(objects, objectList...)
+	}
+	return objects
+}
+
+func TestBuildCollectsAllNamespaces(t *testing.T) {
+	var objects []runtime.Object
+	for _, namespace := range []string{"ns-0", "ns-1", "ns-2"} {
+		objects = append(objects, objectsOf(
+			deploymentObjects(namespace, "api", "quay.io/test/api:1.0", 2),
+			deploymentObjects(namespace, "api-gateway", "quay.io/test/api-gateway:1.0", 2),
+			orphanObjects(namespace),
+			knativeServiceObjects(namespace, "hello", "quay.io/test/hello:latest"),
+			imageStreamObjects(namespace, "legacy", testDigest),
+		)...)
+	}
+	topology, err := newFakeBuilder(objects...).build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if got := len(topology.AllNamespaces()); got != 3 {
+		t.Fatalf("Expected 3 namespaces, got %d", got)
+	}
+	for _, namespace := range topology.AllNamespaces() {
+		var orphans []string
+		for _, applicationProvider := range namespace.AllApplicationProviders() {
+			if model.IsOrphanProvider(applicationProvider) {
+				orphans = append(orphans, applicationProvider.(model.Resource).Name())
+			}
+		}
+		if got := len(namespace.AllApplicationProviders()); got != 6 {
+			t.Errorf("Expected 6 applications in %s, got %d", namespace.Name(), got)
+		}
+		if len(orphans) != 2 {
+			t.Errorf("Expected the orphan Job and Pod in %s, got %v", namespace.Name(), orphans)
+		}
+		for _, name := range []string{"api", "api-gateway"} {
+			deployment := namespace.LookupByKindAndName("Deployment", name)
+			if deployment == nil {
+				t.Fatalf("Missing Deployment %s in %s", name, namespace.Name())
+			}
+			pods := namespace.AllPodsOf(deployment)
+			if len(pods) != 2 {
+				t.Errorf("Expected 2 pods of %s in %s, got %d", name, namespace.Name(), len(pods))
+			}
+			for _, pod := range pods {
+				if len(namespace.OwnersOf(pod)) != 2 || namespace.OwnersOf(pod)[1].Name() != name {
+					t.Errorf("Pod %s is not owned by %s", pod.Name(), name)
+				}
+			}
+		}
+
+		imageName := fmt.Sprintf("image-registry.openshift-image-registry.svc:5000/%s/legacy@%s", namespace.Name(), testDigest)
+		image, ok := topology.ImageByName(imageName)
+		if !ok {
+			t.Fatalf("Missing image %s", imageName)
+		}
+		if got := image.ImageVersion(); got != "1.0" {
+			t.Errorf("Expected version 1.0 of %s, got %s", imageName, got)
+		}
+	}
+}
+
+func TestBuildKnativeServices(t *testing.T) {
+	topology, err := newFakeBuilder(knativeServiceObjects("ns-0", "hello", "quay.io/test/hello:latest")...).build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	namespace := topology.NamespaceByName("ns-0")
+	service := namespace.LookupByKindAndName("KnativeService", "hello")
+	if service == nil {
+		t.Fatalf("Missing Knative Service hello")
+	}
+	applicationConfigs := service.(model.ApplicationProvider).ApplicationConfigs()
+	if len(applicationConfigs) != 1 || applicationConfigs[0].ImageDigest != "quay.io/test/hello@"+testDigest {
+		t.Errorf("Expected the image digest of the latest ready Revision, got %v", applicationConfigs)
+	}
+	if pods := namespace.AllPodsOf(service); len(pods) != 1 {
+		t.Errorf("Expected 1 pod of the Knative Service, got %d", len(pods))
+	}
+}
+
+func TestBuildWithoutKnative(t *testing.T) {
+	objects := objectsOf(deploymentObjects("ns-0", "api", "quay.io/test/api:1.0", 1), knativeServiceObjects("ns-0", "hello", "quay.io/test/hello:latest"))
+
+	// Knative Serving is not installed
+	builder := newFakeBuilder(objects...)
+	fakeDiscovery := builder.discoveryClient.(*discoveryFake.FakeDiscovery)
+	fakeDiscovery.Resources = fakeDiscovery.Resources[:len(fakeDiscovery.Resources)-1]
+	builder.dynamicClient.(*dynamicFake.FakeDynamicClient).PrependReactor("list", "services", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("unexpected list of Knative Services")
+	})
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace := topology.NamespaceByName("ns-0")
+	if len(namespace.ResourcesByKind("KnativeService")) != 0 || namespace.LookupByKindAndName("Deployment", "api") == nil {
+		t.Errorf("Expected only the Deployment api without Knative")
+	}
+
+	// The exporter is not allowed to read the Knative Services
+	builder = newFakeBuilder(objects...)
+	builder.dynamicClient.(*dynamicFake.FakeDynamicClient).PrependReactor("list", "services", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8sErrors.NewForbidden(knativeServicesResource.GroupResource(), "", errors.New("access denied"))
+	})
+	topology, err = builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace = topology.NamespaceByName("ns-0")
+	if len(namespace.ResourcesByKind("KnativeService")) != 0 || namespace.LookupByKindAndName("Deployment", "api") == nil {
+		t.Errorf("Expected only the Deployment api when Knative is forbidden")
+	}
+}
+
+func TestBuildVanillaKubernetes(t *testing.T) {
+	cronJob := &k8sBatchV1beta1.CronJob{ObjectMeta: objectMeta("ns-0", "report")}
+	cronJob.Spec.Schedule = "0 * * * *"
+	cronJob.Spec.JobTemplate.Spec.Template = podTemplate("quay.io/test/report:1.0")
+	builder := newFakeBuilder(append(deploymentObjects("ns-0", "api", "quay.io/test/api:1.0", 1), cronJob)...)
+	builder.discoveryClient.(*discoveryFake.FakeDiscovery).Resources = []*k8sMetaV1.APIResourceList{
+		{GroupVersion: "batch/v1", APIResources: []k8sMetaV1.APIResource{{Name: "jobs", Kind: "Job", Namespaced: true}}},
+		{GroupVersion: "batch/v1beta1", APIResources: []k8sMetaV1.APIResource{{Name: "cronjobs", Kind: "CronJob", Namespaced: true}}},
+	}
+	builder.clientAppsV1.(*appsFakeV1.FakeAppsV1).PrependReactor("*", "*", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("unexpected OpenShift apps API call")
+	})
+	builder.clientImagesV1.(*imageFakeV1.FakeImageV1).PrependReactor("*", "*", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("unexpected OpenShift image API call")
+	})
+
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace := topology.NamespaceByName("ns-0")
+	if len(namespace.ResourcesByKind("DeploymentConfig")) != 0 {
+		t.Errorf("Unexpected DeploymentConfigs in vanilla Kubernetes")
+	}
+	report := namespace.LookupByKindAndName("CronJob", "report")
+	if report == nil {
+		t.Fatalf("Missing batch/v1beta1 CronJob")
+	}
+	applicationConfigs := report.(model.ApplicationProvider).ApplicationConfigs()
+	if len(applicationConfigs) != 1 || applicationConfigs[0].ImageName != "quay.io/test/report:1.0" {
+		t.Errorf("Unexpected application configs of CronJob: %v", applicationConfigs)
+	}
+}
+
+func TestBuildConfiguredNamespaces(t *testing.T) {
+	var objects []runtime.Object
+	for _, namespace := range []string{"ns-1", "ns-2", "ns-3"} {
+		objects = append(objects, deploymentObjects(namespace, "api", "quay.io/test/api:1.0", 1)...)
+	}
+	builder := newFakeBuilder(objects...)
+	builder.runnerConfig.SetNamespaces("ns-1, ns-3")
+	builder.k8sCoreClientV1.(*k8sCoreFakeV1.FakeCoreV1).PrependReactor("list", "namespaces", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8sErrors.NewForbidden(k8sCoreV1.Resource("namespaces"), "", errors.New("cluster-scoped access denied"))
+	})
+
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if namespaces := topology.AllNamespaces(); len(namespaces) != 2 {
+		t.Fatalf("Expected 2 namespaces, got %d", len(namespaces))
+	}
+	if deployment := topology.NamespaceByName("ns-3").LookupByKindAndName("Deployment", "api"); deployment == nil {
+		t.Errorf("Missing Deployment api in ns-3")
+	}
+
+	// The name filters apply to the configured namespaces too
+	builder = newFakeBuilder(objects...)
+	builder.runnerConfig.SetNamespaces("ns-1, ns-3")
+	if err := builder.runnerConfig.SetNamespaceExcludes("ns-3"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	topology, err = builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if namespaces := topology.AllNamespaces(); len(namespaces) != 1 || namespaces[0].Name() != "ns-1" {
+		t.Errorf("Expected only namespace ns-1, got %d namespaces", len(namespaces))
+	}
+}
+
+func TestBuildFilteredNamespaces(t *testing.T) {
+	var namespaces []runtime.Object
+	for _, name := range []string{"ns-1", "ns-10", "ns-2", "openshift-monitoring", "kube-system", "billing"} {
+		namespaces = append(namespaces, &k8sCoreV1.Namespace{ObjectMeta: k8sMetaV1.ObjectMeta{Name: name, Annotations: map[string]string{"owner": name}}})
+	}
+
+	topology, err := newFakeBuilder(namespaces...).build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(topology.AllNamespaces()) != 4 || topology.NamespaceByName("kube-system") != nil {
+		t.Errorf("Expected the system namespaces to be excluded by default, got %d namespaces", len(topology.AllNamespaces()))
+	}
+
+	builder := newFakeBuilder(namespaces...)
+	builder.runnerConfig.SetNamespaceIncludes("/^ns-1[0-9]?$/,kube-*")
+	builder.runnerConfig.SetNamespaceExcludes("ns-1?")
+	topology, err = builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(topology.AllNamespaces()) != 2 || topology.NamespaceByName("ns-1") == nil || topology.NamespaceByName("kube-system") == nil {
+		t.Errorf("Expected namespaces ns-1 and kube-system, got %d namespaces", len(topology.AllNamespaces()))
+	}
+
+	builder = newFakeBuilder(namespaces...)
+	builder.runnerConfig.SetNamespaceAnnotations("owner in (billing,kube-system)")
+	topology, err = builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(topology.AllNamespaces()) != 1 || topology.NamespaceByName("billing") == nil {
+		t.Errorf("Expected only namespace billing, got %d namespaces", len(topology.AllNamespaces()))
+	}
+}
+
+func TestBuildFilteredWorkloads(t *testing.T) {
+	billing := deploymentObjects("ns-0", "billing-api", "quay.io/test/billing-api:1.0", 1)
+	billing[0].(*k8sAppsV1.Deployment).Labels = map[string]string{"app.kubernetes.io/part-of": "billing"}
+	objects := objectsOf(billing, deploymentObjects("ns-0", "api", "quay.io/test/api:1.0", 2), orphanObjects("ns-0"))
+
+	builder := newFakeBuilder(objects...)
+	builder.runnerConfig.SetWorkloadSelector("app.kubernetes.io/part-of=billing")
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace := topology.NamespaceByName("ns-0")
+	applicationProviders := namespace.AllApplicationProviders()
+	if len(applicationProviders) != 1 || applicationProviders[0].(model.Resource).Name() != "billing-api" {
+		t.Fatalf("Expected only the billing-api application, got %d applications", len(applicationProviders))
+	}
+	if pods := namespace.AllPodsOf(applicationProviders[0].(model.Resource)); len(pods) != 1 {
+		t.Errorf("Expected 1 pod of billing-api, got %d", len(pods))
+	}
+
+	builder = newFakeBuilder(objects...)
+	builder.runnerConfig.SetKinds("StatefulSet,job")
+	builder.k8sAppsClientV1.(*k8sAppsFakeV1.FakeAppsV1).PrependReactor("list", "*", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		if resource := action.GetResource().Resource; action.GetResource().Group != "apps" || resource == "statefulsets" || resource == "replicasets" {
+			return false, nil, nil
+		}
+		return true, nil, fmt.Errorf("unexpected list of %s", action.GetResource().Resource)
+	})
+	topology, err = builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace = topology.NamespaceByName("ns-0")
+	applicationProviders = namespace.AllApplicationProviders()
+	if len(applicationProviders) != 1 || applicationProviders[0].(model.Resource).Kind() != "Job" {
+		t.Errorf("Expected only the migration Job, got %d applications", len(applicationProviders))
+	}
+	if resources := append(namespace.ResourcesByKind("ReplicaSet"), namespace.ResourcesByKind("Pod")...); len(resources) != 0 {
+		t.Errorf("Expected no ReplicaSets and Pods of the unselected workloads, got %d", len(resources))
+	}
+
+	// The pods of the selected workloads are collected even when the Pods are not selected
+	builder = newFakeBuilder(objectsOf(objects, knativeServiceObjects("ns-0", "greeter", "quay.io/test/greeter:1.0"))...)
+	builder.runnerConfig.SetKinds("Deployment,KnativeService")
+	topology, err = builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace = topology.NamespaceByName("ns-0")
+	if applicationProviders = namespace.AllApplicationProviders(); len(applicationProviders) != 3 {
+		t.Errorf("Expected the 2 Deployments and the Knative Service, got %d applications", len(applicationProviders))
+	}
+	for name, pods := range map[string]int{"billing-api": 1, "api": 2} {
+		if got := len(namespace.AllPodsOf(namespace.LookupByKindAndName("Deployment", name))); got != pods {
+			t.Errorf("Expected %d pods of %s, got %d", pods, name, got)
+		}
+	}
+
+	builder = newFakeBuilder(knativeServiceObjects("ns-0", "greeter", "quay.io/test/greeter:1.0")...)
+	builder.runnerConfig.SetKinds("KnativeService")
+	topology, err = builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace = topology.NamespaceByName("ns-0")
+	if applicationProviders = namespace.AllApplicationProviders(); len(applicationProviders) != 1 {
+		t.Fatalf("Expected only the Knative Service, got %d applications", len(applicationProviders))
+	}
+	if pods := namespace.AllPodsOf(applicationProviders[0].(model.Resource)); len(pods) != 1 {
+		t.Errorf("Expected 1 pod of the Knative Service, got %d", len(pods))
+	}
+}
+
+func TestRunningImageDigests(t *testing.T) {
+	deployment := &k8sAppsV1.Deployment{ObjectMeta: objectMeta("ns-0", "billing-api")}
+	deployment.Spec.Template = podTemplate("quay.io/test/billing-api:latest")
+	replicaSet := &k8sAppsV1.ReplicaSet{ObjectMeta: objectMeta("ns-0", "billing-api-6b7c", model.ControllerReference("Deployment", deployment.Name, deployment.UID))}
+	objects := []runtime.Object{deployment, replicaSet}
+	for i, imageID := range []string{"docker-pullable://quay.io/test/billing-api@" + testDigest, "quay.io/test/billing-api@" + otherDigest, "sha256:local"} {
+		pod := &k8sCoreV1.Pod{ObjectMeta: objectMeta("ns-0", fmt.Sprintf("billing-api-6b7c-%d", i), model.ControllerReference("ReplicaSet", replicaSet.Name, replicaSet.UID))}
+		pod.Status.ContainerStatuses = []k8sCoreV1.ContainerStatus{{Name: "main", ImageID: imageID}}
+		objects = append(objects, pod)
+	}
+	objects = append(objects, deploymentObjects("ns-0", "api", "quay.io/test/api:1.0", 2)...)
+
+	topology, err := newFakeBuilder(objects...).build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace := topology.NamespaceByName("ns-0")
+	digests := namespace.RunningImageDigests(namespace.LookupByKindAndName("Deployment", "billing-api"), "main")
+	if len(digests) != 2 || digests[0] != testDigest || digests[1] != otherDigest {
+		t.Errorf("Expected the digests of the 2 pods pulled from the registry, got %v", digests)
+	}
+	if digests := namespace.RunningImageDigests(namespace.LookupByKindAndName("Deployment", "api"), "main"); len(digests) != 0 {
+		t.Errorf("Expected no digests for pods without container statuses, got %v", digests)
+	}
+}
+
+func TestImageTriggers(t *testing.T) {
+	deployment := &k8sAppsV1.Deployment{ObjectMeta: objectMeta("ns-0", "web")}
+	deployment.Annotations = map[string]string{model.ImageTriggersAnnotation: `[{"from":{"kind":"ImageStreamTag","name":"web:latest"},"fieldPath":"spec.template.spec.containers[?(@.name==\"main\")].image"}]`}
+	deployment.Spec.Template = podTemplate("image-registry.openshift-image-registry.svc:5000/ns-0/web:latest")
+	pod := &k8sCoreV1.Pod{ObjectMeta: objectMeta("ns-0", "web-0", model.ControllerReference("Deployment", deployment.Name, deployment.UID))}
+	pod.Status.ContainerStatuses = []k8sCoreV1.ContainerStatus{{Name: "main", ImageID: "image-registry.openshift-image-registry.svc:5000/ns-0/web@" + testDigest}}
+
+	deploymentConfig := &appsV1.DeploymentConfig{ObjectMeta: objectMeta("ns-0", "worker")}
+	template := podTemplate("image-registry.openshift-image-registry.svc:5000/shared/base@" + otherDigest)
+	deploymentConfig.Spec.Template = &template
+	deploymentConfig.Spec.Triggers = []appsV1.DeploymentTriggerPolicy{{Type: appsV1.DeploymentTriggerOnImageChange,
+		ImageChangeParams: &appsV1.DeploymentTriggerImageChangeParams{ContainerNames: []string{"main"},
+			From: k8sCoreV1.ObjectReference{Kind: "ImageStreamTag", Namespace: "shared", Name: "base:stable"}}}}
+
+	builder := newFakeBuilder(append(deploymentObjects("ns-0", "api", "quay.io/test/api:1.0", 1), deployment, pod, deploymentConfig,
+		&imageV1.ImageStreamTag{ObjectMeta: k8sMetaV1.ObjectMeta{Namespace: "ns-0", Name: "web:latest"}, Image: imageV1.Image{ObjectMeta: k8sMetaV1.ObjectMeta{Name: otherDigest}}},
+		&imageV1.ImageStreamTag{ObjectMeta: k8sMetaV1.ObjectMeta{Namespace: "shared", Name: "base:stable"}, Image: imageV1.Image{ObjectMeta: k8sMetaV1.ObjectMeta{Name: otherDigest}}},
+	)...)
+	builder.runnerConfig.SetNamespaces("ns-0")
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace := topology.NamespaceByName("ns-0")
+	for _, expected := range []struct {
+		kind, name string
+		trigger    *model.ImageTrigger
+	}{
+		{"Deployment", "web", &model.ImageTrigger{Namespace: "ns-0", Name: "web:latest"}},
+		{"DeploymentConfig", "worker", &model.ImageTrigger{Namespace: "shared", Name: "base:stable"}},
+		{"Deployment", "api", nil},
+	} {
+		resource := namespace.LookupByKindAndName(expected.kind, expected.name)
+		if resource == nil {
+			t.Fatalf("Missing %s %s", expected.kind, expected.name)
+		}
+		trigger := resource.(model.ApplicationProvider).ApplicationConfigs()[0].ImageTrigger
+		if (trigger == nil) != (expected.trigger == nil) || (trigger != nil && *trigger != *expected.trigger) {
+			t.Errorf("Expected trigger %v of %s %s, got %v", expected.trigger, expected.kind, expected.name, trigger)
+			continue
+		}
+		if trigger == nil {
+			continue
+		}
+		if latestDigest, ok := namespace.LatestImageOf(*trigger); !ok || latestDigest != otherDigest {
+			t.Errorf("Expected the latest image %s of %s, got %s", otherDigest, trigger.Name, latestDigest)
+		}
+	}
+}
+
+func TestImageCache(t *testing.T) {
+	// The same image runs in every namespace
+	var objects []runtime.Object
+	for _, namespace := range []string{"ns-0", "ns-1", "ns-2"} {
+		objects = append(objects, imageStreamObjects(namespace, "legacy", testDigest)...)
+	}
+	countLookups := func(builder *ModelBuilder) *int32 {
+		var lookups int32
+		builder.clientImagesV1.(*imageFakeV1.FakeImageV1).PrependReactor("get", "imagestreamimages", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+			atomic.AddInt32(&lookups, 1)
+			return false, nil, nil
+		})
+		return &lookups
+	}
+	cacheFile := filepath.Join(t.TempDir(), "images.json")
+	builder := newFakeBuilder(objects...)
+	builder.imageCache = newImageCache(cacheFile)
+	lookups := countLookups(builder)
+	if _, err := builder.build(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if atomic.LoadInt32(lookups) == 0 || builder.imageCache.misses != int(atomic.LoadInt32(lookups)) {
+		t.Fatalf("Expected a miss for every ImageStreamImage lookup, got %d misses and %d lookups", builder.imageCache.misses, atomic.LoadInt32(lookups))
+	}
+	builder.imageCache.save()
+
+	// The failed lookups are misses too
+	failing := newFakeBuilder(objects...)
+	failing.clientImagesV1.(*imageFakeV1.FakeImageV1).PrependReactor("get", "imagestreamimages", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("unavailable")
+	})
+	lookups = countLookups(failing)
+	if _, err := failing.build(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if atomic.LoadInt32(lookups) != 3 || failing.imageCache.misses != 3 {
+		t.Errorf("Expected a miss for every failed lookup, got %d misses and %d lookups", failing.imageCache.misses, atomic.LoadInt32(lookups))
+	}
+
+	// The images of the cache file are reused by the next execution within the persistent time to live, without any
+	// lookup
+	builder = newFakeBuilder(objects...)
+	builder.imageCache = newImageCache(cacheFile)
+	builder.imageCache.expire(config.DefaultPersistentImageCacheTTL)
+	lookups = countLookups(builder)
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if atomic.LoadInt32(lookups) != 0 {
+		t.Errorf("Expected no ImageStreamImage lookups with cached images, got %d", atomic.LoadInt32(lookups))
+	}
+	imageName := fmt.Sprintf("image-registry.openshift-image-registry.svc:5000/ns-2/legacy@%s", testDigest)
+	if image, ok := topology.ImageByName(imageName); !ok || image.ImageName() != "legacy" {
+		t.Errorf("Expected cached image of %s, got %v", imageName, image)
+	}
+
+	builder.imageCache.expire(0)
+	builder.imageCache.mutex.Lock()
+	defer builder.imageCache.mutex.Unlock()
+	if len(builder.imageCache.images) != 0 || len(builder.imageCache.missing) != 0 {
+		t.Errorf("Expected no entries after expiration, got %d images and %d missing", len(builder.imageCache.images), len(builder.imageCache.missing))
+	}
+}
+
+func TestVerifyBuilds(t *testing.T) {
+	var objects []runtime.Object
+	for name, digest := range map[string]string{"legacy": testDigest, "pruned": otherDigest} {
+		deploymentConfig := &appsV1.DeploymentConfig{ObjectMeta: objectMeta("ns-0", name)}
+		template := podTemplate(fmt.Sprintf("image-registry.openshift-image-registry.svc:5000/ns-0/%s@%s", name, digest))
+		deploymentConfig.Spec.Template = &template
+		objects = append(objects, deploymentConfig)
+	}
+	imageStreamImage := func(name string, digest string, labels string) *imageV1.ImageStreamImage {
+		return &imageV1.ImageStreamImage{ObjectMeta: k8sMetaV1.ObjectMeta{Namespace: "ns-0", Name: name + "@" + digest},
+			Image: imageV1.Image{DockerImageReference: fmt.Sprintf("image-registry.openshift-image-registry.svc:5000/ns-0/%s@%s", name, digest),
+				DockerImageMetadata: runtime.RawExtension{Raw: []byte(`{"Config":{"Labels":` + labels + `}}`)}}}
+	}
+	build := &buildV1.Build{ObjectMeta: objectMeta("ns-0", "legacy-3")}
+	build.Spec.Source.Git = &buildV1.GitBuildSource{URI: "https://github.com/team/legacy.git"}
+	build.Spec.Revision = &buildV1.SourceRevision{Git: &buildV1.GitSourceRevision{Commit: "4f2c1d0"}}
+	build.Status.Output.To = &buildV1.BuildStatusOutputTo{ImageDigest: testDigest}
+	objects = append(objects, build,
+		imageStreamImage("legacy", testDigest, `{"io.openshift.build.commit.id":"4f2c1d0","io.openshift.build.source-location":"https://github.com/team/legacy.git","io.openshift.build.name":"legacy-3"}`),
+		imageStreamImage("pruned", otherDigest, `{"io.openshift.build.commit.id":"9e8d7c6","io.openshift.build.name":"pruned-1","io.openshift.build.namespace":"ci"}`))
+
+	builder := newFakeBuilder(objects...)
+	builder.config.SetVerifyBuilds(true)
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace := topology.NamespaceByName("ns-0")
+	for _, expected := range []struct {
+		ref   model.BuildReference
+		build *model.Build
+	}{
+		{model.BuildReference{Namespace: "ns-0", Name: "legacy-3"},
+			&model.Build{SourceLocation: "https://github.com/team/legacy.git", CommitId: "4f2c1d0", ImageDigest: testDigest}},
+		// The pruned Build is loaded as missing
+		{model.BuildReference{Namespace: "ci", Name: "pruned-1"}, nil},
+	} {
+		build, ok := namespace.BuildOf(expected.ref)
+		if !ok || (build == nil) != (expected.build == nil) || (build != nil && *build != *expected.build) {
+			t.Errorf("Expected Build %+v of %s, got %+v loaded %t", expected.build, expected.ref.Name, build, ok)
+		}
+	}
+}
+
+func TestFormatAllProviderKinds(t *testing.T) {
+	customKinds, err := config.NewCustomKindsFromProperties(properties.MustLoadString(`
+kinds=rollout
+rollout.resource=rollouts.v1alpha1.argoproj.io
+rollout.pod-template={.spec.template}
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	statefulSet := &k8sAppsV1.StatefulSet{ObjectMeta: objectMeta("ns-0", "db")}
+	statefulSet.Spec.Template = podTemplate("quay.io/test/db:1.0")
+	replicaSet := &k8sAppsV1.ReplicaSet{ObjectMeta: objectMeta("ns-0", "standalone")}
+	replicaSet.Spec.Template = podTemplate("quay.io/test/standalone:1.0")
+	rollout := customResource("ns-0", "argoproj.io/v1alpha1", "Rollout", "canary")
+	unstructured.SetNestedSlice(rollout.Object, []interface{}{map[string]interface{}{"name": "main", "image": "quay.io/test/canary:2.0"}}, "spec", "template", "spec", "containers")
+	knativeService := knativeServiceObjects("ns-0", "hello", "quay.io/test/hello:latest")
+
+	builder := newFakeBuilder(objectsOf(
+		deploymentObjects("ns-0", "api", "quay.io/test/api:1.0", 2),
+		orphanObjects("ns-0"),
+		knativeService,
+		imageStreamObjects("ns-0", "legacy", testDigest),
+		[]runtime.Object{statefulSet, replicaSet},
+	)...)
+	builder.config.SetCustomKinds(customKinds)
+	builder.initCustomWorkloadKinds()
+	listKinds := map[schema.GroupVersionResource]string{customKinds[0].Resource(): "RolloutList"}
+	for resource, listKind := range knativeListKinds {
+		listKinds[resource] = listKind
+	}
+	builder.dynamicClient = dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, knativeService[0], knativeService[1], knativeService[2], rollout)
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expectedApplications := []string{"api", "canary", "db", "debug", "hello", "legacy", "migration", "standalone"}
+	for _, contentType := range []config.ContentType{config.Text, config.CSV} {
+		builder.config.SetContentType(contentType)
+		output := formatter.NewFormatterForConfig(builder.config).Format(topology).String()
+		for _, name := range expectedApplications {
+			if !strings.Contains(output, name) {
+				t.Errorf("Missing application %s in the %s output", name, contentType)
+			}
+		}
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	const configDigest = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "robot" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/team/app/manifests/" + testDigest:
+			fmt.Fprintf(w, `{"config":{"digest":"%s"}}`, configDigest)
+		case "/v2/team/app/blobs/" + configDigest:
+			fmt.Fprint(w, `{"created":"2022-10-01T10:00:00Z","config":{"Labels":{"version":"4.2","release":"7"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	registryHost := strings.TrimPrefix(server.URL, "https://")
+	imageName := registryHost + "/team/app@" + testDigest
+
+	deployment := &k8sAppsV1.Deployment{ObjectMeta: objectMeta("ns-0", "pinned")}
+	deployment.Spec.Template = podTemplate(imageName)
+	deployment.Spec.Template.Spec.ServiceAccountName = "builder"
+	serviceAccount := &k8sCoreV1.ServiceAccount{ObjectMeta: objectMeta("ns-0", "builder"),
+		ImagePullSecrets: []k8sCoreV1.LocalObjectReference{{Name: "pull"}}}
+	secret := &k8sCoreV1.Secret{ObjectMeta: objectMeta("ns-0", "pull"), Type: k8sCoreV1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{k8sCoreV1.DockerConfigJsonKey: []byte(fmt.Sprintf(`{"auths":{"%s":{"username":"robot","password":"secret"}}}`, registryHost))}}
+
+	builder := newFakeBuilder(deployment, serviceAccount, secret)
+	builder.registryClient = registry.NewClient(server.Client(), nil, "")
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	image, ok := topology.ImageByName(imageName)
+	if !ok {
+		t.Fatalf("Missing image %s", imageName)
+	}
+	if version, source := model.DefaultVersionExtractor.ImageVersion(image, model.ApplicationConfig{}); version != "4.2-7" || source != config.LabelVersionStrategy {
+		t.Errorf("Expected version 4.2-7 from the image labels, got %s from %s", version, source)
+	}
+}
+
+func TestBuildFallbackToCurrentNamespace(t *testing.T) {
+	builder := newFakeBuilder(objectsOf(
+		deploymentObjects("ns-1", "api", "quay.io/test/api:1.0", 1),
+		deploymentObjects("ns-2", "api", "quay.io/test/api:1.0", 1),
+	)...)
+	builder.currentNamespace = "ns-2"
+	builder.k8sCoreClientV1.(*k8sCoreFakeV1.FakeCoreV1).PrependReactor("list", "namespaces", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8sErrors.NewForbidden(k8sCoreV1.Resource("namespaces"), "", errors.New("cluster-scoped access denied"))
+	})
+
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespaces := topology.AllNamespaces()
+	if len(namespaces) != 1 || namespaces[0].Name() != "ns-2" {
+		t.Fatalf("Expected only the current namespace ns-2, got %d namespaces", len(namespaces))
+	}
+
+	if err := builder.runnerConfig.SetNamespaceIncludes("ns-1"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	builder.topologyModel = model.NewTopologyModel()
+	topology, err = builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if namespaces := topology.AllNamespaces(); len(namespaces) != 0 {
+		t.Errorf("Expected no namespaces when the current one is filtered, got %d namespaces", len(namespaces))
+	}
+}
+
+func TestBuildCustomWorkloads(t *testing.T) {
+	customKinds, err := config.NewCustomKindsFromProperties(properties.MustLoadString(`
+kinds=argo,kieapp
+argo.resource=rollouts.v1alpha1.argoproj.io
+argo.pod-template={.spec.template}
+kieapp.resource=kieapps.v2.app.kiegroup.org
+kieapp.containers={.spec.objects.servers[*]}
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	cfg := &config.Config{}
+	cfg.SetCustomKinds(customKinds)
+
+	rollout := customResource("ns-0", "argoproj.io/v1alpha1", "Rollout", "canary")
+	unstructured.SetNestedSlice(rollout.Object, []interface{}{map[string]interface{}{"name": "main", "image": "quay.io/test/canary:2.0"}}, "spec", "template", "spec", "containers")
+	kieApp := customResource("ns-0", "app.kiegroup.org/v2", "KieApp", "rhpam")
+	unstructured.SetNestedSlice(kieApp.Object, []interface{}{
+		map[string]interface{}{"name": "kieserver", "image": "quay.io/test/kieserver:7.13"},
+		map[string]interface{}{"name": "smartrouter", "image": "quay.io/test/smartrouter:7.13"},
+	}, "spec", "objects", "servers")
+
+	builder := newFakeBuilder(rollout, kieApp)
+	builder.config = cfg
+	builder.initCustomWorkloadKinds()
+	listKinds := map[schema.GroupVersionResource]string{customKinds[0].Resource(): "RolloutList", customKinds[1].Resource(): "KieAppList"}
+	for resource, listKind := range knativeListKinds {
+		listKinds[resource] = listKind
+	}
+	builder.dynamicClient = dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, rollout, kieApp)
+
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace := topology.NamespaceByName("ns-0")
+	for kind, containers := range map[string]int{"Rollout": 1, "KieApp": 2} {
+		resources := namespace.ResourcesByKind(kind)
+		if len(resources) != 1 {
+			t.Fatalf("Expected 1 %s, got %d", kind, len(resources))
+		}
+		if got := len(resources[0].(model.ApplicationProvider).ApplicationConfigs()); got != containers {
+			t.Errorf("Expected %d containers in %s, got %d", containers, kind, got)
+		}
+	}
+
+	// The custom kinds are selected by their Kind too
+	builder.runnerConfig.SetKinds("Rollout")
+	if err := builder.runnerConfig.ValidateKinds(cfg.CustomKinds()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	builder.topologyModel = model.NewTopologyModel()
+	topology, err = builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	applicationProviders := topology.NamespaceByName("ns-0").AllApplicationProviders()
+	if len(applicationProviders) != 1 || applicationProviders[0].(model.Resource).Kind() != "Rollout" {
+		t.Errorf("Expected only the Rollout, got %d applications", len(applicationProviders))
+	}
+	builder.runnerConfig.SetKinds("Rollout,Deploymnet")
+	if err := builder.runnerConfig.ValidateKinds(cfg.CustomKinds()); err == nil {
+		t.Errorf("Expected error for the unsupported kind Deploymnet")
+	}
+
+	// The custom kinds which cannot be read are skipped
+	builder.runnerConfig.SetKinds("")
+	builder.topologyModel = model.NewTopologyModel()
+	builder.dynamicClient.(*dynamicFake.FakeDynamicClient).PrependReactor("list", "rollouts", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8sErrors.NewForbidden(customKinds[0].Resource().GroupResource(), "", errors.New("access denied"))
+	})
+	topology, err = builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace = topology.NamespaceByName("ns-0")
+	if len(namespace.ResourcesByKind("Rollout")) != 0 || len(namespace.ResourcesByKind("KieApp")) != 1 {
+		t.Errorf("Expected only the KieApp when the Rollouts are forbidden")
+	}
+}
+
+func TestResolveOperatorOwners(t *testing.T) {
+	kieApp := customResource("ns-0", "app.kiegroup.org/v2", "KieApp", "rhpam")
+	deployments := deploymentObjects("ns-0", "api", "quay.io/test/api:1.0", 1)
+	for _, name := range []string{"rhpam-kieserver", "rhpam-rhpamcentr"} {
+		deployment := &k8sAppsV1.Deployment{ObjectMeta: objectMeta("ns-0", name, model.ControllerReference("KieApp", kieApp.GetName(), kieApp.GetUID()))}
+		deployment.ObjectMeta.OwnerReferences[0].APIVersion = kieApp.GetAPIVersion()
+		deployment.Spec.Template = podTemplate(fmt.Sprintf("quay.io/test/%s:7.13", name))
+		deployments = append(deployments, deployment)
+	}
+	operandPod := &k8sCoreV1.Pod{ObjectMeta: objectMeta("ns-0", "rhpam-smartrouter", model.ControllerReference("KieApp", kieApp.GetName(), kieApp.GetUID())),
+		Spec: podTemplate("quay.io/test/rhpam-smartrouter:7.13").Spec}
+	operandPod.ObjectMeta.OwnerReferences[0].APIVersion = kieApp.GetAPIVersion()
+
+	builder := newFakeBuilder(append(deployments, kieApp, operandPod)...)
+	fakeDiscovery := builder.discoveryClient.(*discoveryFake.FakeDiscovery)
+	fakeDiscovery.Resources = append(fakeDiscovery.Resources, &k8sMetaV1.APIResourceList{
+		GroupVersion: "app.kiegroup.org/v2",
+		APIResources: []k8sMetaV1.APIResource{{Name: "kieapps", Kind: "KieApp", Namespaced: true}},
+	})
+
+	topology, err := builder.build(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	namespace := topology.NamespaceByName("ns-0")
+	for _, name := range []string{"rhpam-kieserver", "rhpam-rhpamcentr"} {
+		owner := namespace.TopOwnerOf(namespace.LookupByKindAndName("Deployment", name))
+		if owner == nil || owner.Kind() != "KieApp" || owner.Name() != "rhpam" {
+			t.Errorf("Expected KieApp rhpam as owner of %s, got %v", name, owner)
+		}
+	}
+	if owner := namespace.TopOwnerOf(namespace.LookupByKindAndName("Deployment", "api")); owner != nil {
+		t.Errorf("Unexpected owner %s of api", owner.Name())
+	}
+
+	pod, ok := namespace.LookupByKindAndName("Pod", "rhpam-smartrouter").(model.ApplicationProvider)
+	if !ok || model.IsOrphanProvider(pod) {
+		t.Errorf("Expected the Pod owned by the KieApp to be reported as non orphan")
+	}
+	if _, ok := topology.ImageByName("quay.io/test/rhpam-smartrouter:7.13"); !ok {
+		t.Errorf("Expected the image of the Pod owned by the KieApp to be loaded")
+	}
+}
+
+func TestConcurrentBuildsAndReads(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	var objects []runtime.Object
+	for n := 0; n < 10; n++ {
+		objects = append(objects, deploymentObjects(fmt.Sprintf("ns-%d", n), "api", "quay.io/test/api:1.0", 2)...)
+	}
+	for b := 0; b < 4; b++ {
+		builder := newFakeBuilder(objects...)
+		done := make(chan struct{})
+
+		// Read the model while it is being built
+		wg.Add(1)
+		go func(topology *model.TopologyModel) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					for _, namespace := range topology.AllNamespaces() {
+						for _, applicationProvider := range namespace.AllApplicationProviders() {
+							namespace.AllPodsOf(applicationProvider.(model.Resource))
+						}
+					}
+					topology.NamespaceByName("ns-0")
+					topology.ImageByName("quay.io/test/api:1.0")
+				}
+			}
+		}(builder.topologyModel)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done)
+			if _, err := builder.build(context.Background()); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBuildInterruptedByContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := newFakeBuilder(deploymentObjects("ns-0", "api", "quay.io/test/api:1.0", 1)...).build(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected %s, got %v", context.Canceled, err)
+	}
+}
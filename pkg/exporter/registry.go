@@ -0,0 +1,101 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	cfg "github.com/dmartinol/application-exporter/pkg/config"
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	"github.com/dmartinol/application-exporter/pkg/model"
+	"github.com/dmartinol/application-exporter/pkg/registry"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newRegistryClient returns the client fetching the image configurations from the registries, or nil if the registry
+// lookup is disabled
+func newRegistryClient(config *cfg.Config) *registry.Client {
+	if !config.RegistryLookup() {
+		return nil
+	}
+	var credentials registry.Credentials
+	if config.RegistryCredentials() != "" {
+		var err error
+		credentials, err = registry.LoadCredentials(config.RegistryCredentials())
+		if err != nil {
+			logger.Warnf("Cannot load the registry credentials %s: %s", config.RegistryCredentials(), err)
+		}
+	}
+	return registry.NewClient(&http.Client{Timeout: config.RequestTimeout()}, credentials, config.RegistryCacheDir())
+}
+
+// fetchImageConfig fetches the configuration of the given image from its registry, unless already fetched for another
+// container
+func (builder *ModelBuilder) fetchImageConfig(ctx context.Context, namespace string, appConfig model.ApplicationConfig, image *model.Image) {
+	if applicationImage, ok := builder.topologyModel.ImageByName(appConfig.ImageName); ok {
+		if fetched, ok := applicationImage.(*model.Image); ok && fetched.Config != nil {
+			image.Config = fetched.Config
+			return
+		}
+	}
+	ref, ok := appConfig.ImageReference()
+	if !ok {
+		return
+	}
+	imageConfig, err := builder.registryClient.ImageConfig(ctx, ref, builder.pullCredentials(ctx, namespace, appConfig))
+	if err != nil {
+		logger.Warnf("Cannot fetch the configuration of %s: %s", appConfig.ImageName, err)
+		return
+	}
+	image.Config = imageConfig
+}
+
+// pullCredentials returns the credentials of the pull secrets of the given container, including those of its service
+// account, as used by the kubelet to pull the image
+func (builder *ModelBuilder) pullCredentials(ctx context.Context, namespace string, appConfig model.ApplicationConfig) registry.Credentials {
+	serviceAccountName := appConfig.ServiceAccountName
+	if serviceAccountName == "" {
+		serviceAccountName = "default"
+	}
+	key := namespace + "/" + serviceAccountName + "/" + strings.Join(appConfig.ImagePullSecrets, ",")
+	builder.pullCredentialsMutex.Lock()
+	credentials, ok := builder.pullCredentialsCache[key]
+	builder.pullCredentialsMutex.Unlock()
+	if ok {
+		return credentials
+	}
+
+	secretNames := append([]string{}, appConfig.ImagePullSecrets...)
+	serviceAccount, err := builder.k8sCoreClientV1.ServiceAccounts(namespace).Get(ctx, serviceAccountName, k8sMetaV1.GetOptions{})
+	if err != nil {
+		logger.Debugf("Cannot load the service account %s/%s: %s", namespace, serviceAccountName, err)
+	} else {
+		for _, secret := range serviceAccount.ImagePullSecrets {
+			secretNames = append(secretNames, secret.Name)
+		}
+	}
+	credentials = registry.Credentials{}
+	for _, secretName := range secretNames {
+		secret, err := builder.k8sCoreClientV1.Secrets(namespace).Get(ctx, secretName, k8sMetaV1.GetOptions{})
+		if err != nil {
+			logger.Warnf("Cannot load the pull secret %s/%s: %s", namespace, secretName, err)
+			continue
+		}
+		data, ok := secret.Data[k8sCoreV1.DockerConfigJsonKey]
+		if !ok {
+			data = secret.Data[k8sCoreV1.DockerConfigKey]
+		}
+		secretCredentials, err := registry.ParseDockerConfig(data)
+		if err != nil {
+			logger.Warnf("Cannot parse the pull secret %s/%s: %s", namespace, secretName, err)
+			continue
+		}
+		// The secrets of the pod take precedence over those of the service account
+		credentials = secretCredentials.Merge(credentials)
+	}
+	builder.pullCredentialsMutex.Lock()
+	builder.pullCredentialsCache[key] = credentials
+	builder.pullCredentialsMutex.Unlock()
+	return credentials
+}
@@ -0,0 +1,149 @@
+package formatter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/dmartinol/application-exporter/pkg/config"
+	"github.com/dmartinol/application-exporter/pkg/model"
+)
+
+// largestImages is the number of images listed by the footprint report
+const largestImages = 10
+
+// Footprint is the disk usage of the distinct images of a namespace or of a node. The layers shared by the images are
+// stored once, so the disk usage is the size of the distinct layers
+type Footprint struct {
+	Name   string
+	Images int
+	// Size is the total compressed size of the images
+	Size int64
+	// LayersSize is the total compressed size of the distinct layers, or of the images whose layers are unknown
+	LayersSize int64
+
+	images map[string]bool
+	layers map[string]bool
+}
+
+func newFootprint(name string) *Footprint {
+	return &Footprint{Name: name, images: make(map[string]bool), layers: make(map[string]bool)}
+}
+
+// SharedSize returns the size of the layers shared by the images, e.g. not pulled nor stored again
+func (f *Footprint) SharedSize() int64 {
+	return f.Size - f.LayersSize
+}
+
+func (f *Footprint) add(imageName string, image model.ApplicationImage) {
+	if f.images[imageName] {
+		return
+	}
+	f.images[imageName] = true
+	f.Images++
+	f.Size += image.ImageSize()
+	layers := image.ImageLayers()
+	if len(layers) == 0 {
+		f.LayersSize += image.ImageSize()
+		return
+	}
+	for _, layer := range layers {
+		if !f.layers[layer.Digest] {
+			f.layers[layer.Digest] = true
+			f.LayersSize += layer.Size
+		}
+	}
+}
+
+// SizedImage is an image of known size
+type SizedImage struct {
+	Name string
+	Size int64
+}
+
+// ImageFootprints returns the footprint of the images of the collected containers, by namespace and by node of their
+// running pods, sorted by decreasing size, and the largest images
+func ImageFootprints(config *config.Config, topologyModel *model.TopologyModel) ([]*Footprint, []*Footprint, []SizedImage) {
+	byNamespace := make(map[string]*Footprint)
+	byNode := make(map[string]*Footprint)
+	sizes := make(map[string]int64)
+	for _, namespace := range SortedNamespaces(topologyModel) {
+		namespaceName := namespace.Cluster() + "/" + namespace.Name()
+		for _, applicationProvider := range namespace.AllApplicationProviders() {
+			pods := namespace.AllPodsOf(applicationProvider.(model.Resource))
+			for _, applicationConfig := range ApplicationConfigs(config, namespace, applicationProvider) {
+				image, ok := topologyModel.ImageByName(applicationConfig.ImageName)
+				if !ok || image.ImageSize() == 0 {
+					continue
+				}
+				sizes[applicationConfig.ImageName] = image.ImageSize()
+				if byNamespace[namespaceName] == nil {
+					byNamespace[namespaceName] = newFootprint(namespaceName)
+				}
+				byNamespace[namespaceName].add(applicationConfig.ImageName, image)
+				for _, pod := range pods {
+					if !pod.IsRunning() || pod.NodeName() == "" {
+						continue
+					}
+					nodeName := namespace.Cluster() + "/" + pod.NodeName()
+					if byNode[nodeName] == nil {
+						byNode[nodeName] = newFootprint(nodeName)
+					}
+					byNode[nodeName].add(applicationConfig.ImageName, image)
+				}
+			}
+		}
+	}
+
+	var largest []SizedImage
+	for name, size := range sizes {
+		largest = append(largest, SizedImage{Name: name, Size: size})
+	}
+	sort.Slice(largest, func(i, j int) bool {
+		if largest[i].Size != largest[j].Size {
+			return largest[i].Size > largest[j].Size
+		}
+		return largest[i].Name < largest[j].Name
+	})
+	if len(largest) > largestImages {
+		largest = largest[:largestImages]
+	}
+	return sortedFootprints(byNamespace), sortedFootprints(byNode), largest
+}
+
+func sortedFootprints(footprints map[string]*Footprint) []*Footprint {
+	var sorted []*Footprint
+	for _, footprint := range footprints {
+		sorted = append(sorted, footprint)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].LayersSize != sorted[j].LayersSize {
+			return sorted[i].LayersSize > sorted[j].LayersSize
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// ImageSize returns the compressed size of the image of the given container in bytes, or NA if unknown
+func ImageSize(topologyModel *model.TopologyModel, applicationConfig model.ApplicationConfig) string {
+	image, ok := topologyModel.ImageByName(applicationConfig.ImageName)
+	if !ok || image.ImageSize() == 0 {
+		return "NA"
+	}
+	return strconv.FormatInt(image.ImageSize(), 10)
+}
+
+// formatSize returns the given size in bytes with a binary unit, like 12.3MiB
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, exponent := float64(size)/unit, 0
+	for value >= unit && exponent < 3 {
+		value /= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f%ciB", value, "KMGT"[exponent])
+}
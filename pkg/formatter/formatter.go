@@ -3,7 +3,9 @@ package formatter
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dmartinol/application-exporter/pkg/config"
 	logger "github.com/dmartinol/application-exporter/pkg/log"
@@ -13,9 +15,14 @@ import (
 
 type ByNamespaceName []model.NamespaceModel
 
-func (a ByNamespaceName) Len() int           { return len(a) }
-func (a ByNamespaceName) Less(i, j int) bool { return a[i].Name() < a[j].Name() }
-func (a ByNamespaceName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a ByNamespaceName) Len() int      { return len(a) }
+func (a ByNamespaceName) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a ByNamespaceName) Less(i, j int) bool {
+	if a[i].Cluster() != a[j].Cluster() {
+		return a[i].Cluster() < a[j].Cluster()
+	}
+	return a[i].Name() < a[j].Name()
+}
 
 type Formatter struct {
 	config *config.Config
@@ -44,6 +51,196 @@ func SortedNamespaces(topologyModel *model.TopologyModel) []model.NamespaceModel
 	return namespaces
 }
 
+// Owner returns the top-most owner of the given resource, like an operator-managed custom resource, as kind/name
+func Owner(namespace model.NamespaceModel, resource model.Resource) string {
+	if owner := namespace.TopOwnerOf(resource); owner != nil {
+		return fmt.Sprintf("%s/%s", owner.Kind(), owner.Name())
+	}
+	return "NA"
+}
+
+// SortedApplicationProviders returns the application providers of the given namespace grouped by owner and sorted by
+// kind and name
+func SortedApplicationProviders(namespace model.NamespaceModel) []model.ApplicationProvider {
+	type ownedProvider struct {
+		owner    string
+		provider model.ApplicationProvider
+	}
+	// The owners are computed once and sorted with the providers, as not every provider type can be used as a map key
+	applicationProviders := namespace.AllApplicationProviders()
+	ownedProviders := make([]ownedProvider, len(applicationProviders))
+	for i, applicationProvider := range applicationProviders {
+		ownedProviders[i] = ownedProvider{owner: Owner(namespace, applicationProvider.(model.Resource)), provider: applicationProvider}
+	}
+	sort.SliceStable(ownedProviders, func(i, j int) bool {
+		a, b := ownedProviders[i].provider.(model.Resource), ownedProviders[j].provider.(model.Resource)
+		if ownedProviders[i].owner != ownedProviders[j].owner {
+			return ownedProviders[i].owner < ownedProviders[j].owner
+		}
+		if a.Kind() != b.Kind() {
+			return a.Kind() < b.Kind()
+		}
+		return a.Name() < b.Name()
+	})
+	for i, ownedProvider := range ownedProviders {
+		applicationProviders[i] = ownedProvider.provider
+	}
+	return applicationProviders
+}
+
+// ApplicationConfigs returns the application configurations of the given provider, including the ephemeral containers of
+// its pods, matching the configured container roles
+func ApplicationConfigs(config *config.Config, namespace model.NamespaceModel, applicationProvider model.ApplicationProvider) []model.ApplicationConfig {
+	var applicationConfigs []model.ApplicationConfig
+	for _, applicationConfig := range namespace.ApplicationConfigsOf(applicationProvider) {
+		if config.WithContainerRole(applicationConfig.Role.String()) {
+			applicationConfigs = append(applicationConfigs, applicationConfig)
+		}
+	}
+	return applicationConfigs
+}
+
+// ImageDigest returns the resolved image digest, if any, or the digest of the image reference
+func ImageDigest(applicationConfig model.ApplicationConfig) string {
+	if applicationConfig.ImageDigest != "" {
+		return applicationConfig.ImageDigest
+	}
+	if ref, ok := applicationConfig.ImageReference(); ok && ref.Digest != "" {
+		return ref.Digest
+	}
+	return "NA"
+}
+
+// ImageVersion returns the version of the image of the given container, extracted with the configured strategies, and
+// the strategy which found it
+func ImageVersion(config *config.Config, topologyModel *model.TopologyModel, applicationConfig model.ApplicationConfig) (string, string) {
+	applicationImage, ok := topologyModel.ImageByName(applicationConfig.ImageName)
+	if !ok {
+		applicationImage = model.NewImageByRegistry(applicationConfig.ImageName)
+	}
+	versionExtractor := model.VersionExtractor{Strategies: config.VersionStrategies(), TagRegexp: config.VersionTagRegexp(),
+		EnvVars: config.VersionEnvVars(), Fallback: config.VersionFallback()}
+	return versionExtractor.ImageVersion(applicationImage, applicationConfig)
+}
+
+// ImageReference returns the registry, repository and tag of the image reference, with NA for the missing values
+func ImageReference(applicationConfig model.ApplicationConfig) (string, string, string) {
+	ref, ok := applicationConfig.ImageReference()
+	if !ok {
+		return "NA", "NA", "NA"
+	}
+	return orNA(ref.Registry), orNA(ref.Repository), orNA(ref.Tag)
+}
+
+// RunningImageDigest returns the digests of the images running in the given container of the collected pods of the
+// given application, separated by spaces, or NA if none is known. The drift flag is true when the pods run different
+// digests, or a digest different from the one of the image reference
+func RunningImageDigest(namespace model.NamespaceModel, application model.Resource, applicationConfig model.ApplicationConfig) (string, bool) {
+	digests := namespace.RunningImageDigests(application, applicationConfig.ContainerName)
+	if len(digests) == 0 {
+		return "NA", false
+	}
+	drift := len(digests) > 1
+	if digest := ImageDigest(applicationConfig); digest != "NA" && digest != digests[0] {
+		drift = true
+	}
+	return strings.Join(digests, " "), drift
+}
+
+// ImageStreamTag returns the ImageStream and tag of the image trigger of the given container, prefixed by the namespace
+// of the ImageStream when different from the one of the application, and whether the container is behind the latest
+// image of the tag. The container is behind when its image digest, or any of its running digests, differs from the
+// latest one. NA is returned for the unknown values
+func ImageStreamTag(namespace model.NamespaceModel, application model.Resource, applicationConfig model.ApplicationConfig) (string, string, string) {
+	trigger := applicationConfig.ImageTrigger
+	if trigger == nil {
+		return "NA", "NA", "NA"
+	}
+	stream := trigger.Stream()
+	if trigger.Namespace != namespace.Name() {
+		stream = trigger.Namespace + "/" + stream
+	}
+	latestDigest, ok := namespace.LatestImageOf(*trigger)
+	if !ok {
+		return stream, orNA(trigger.Tag()), "NA"
+	}
+	digests := namespace.RunningImageDigests(application, applicationConfig.ContainerName)
+	if digest := ImageDigest(applicationConfig); digest != "NA" {
+		digests = []string{digest}
+	}
+	if len(digests) == 0 {
+		return stream, orNA(trigger.Tag()), "NA"
+	}
+	behind := false
+	for _, digest := range digests {
+		if digest != latestDigest {
+			behind = true
+		}
+	}
+	return stream, orNA(trigger.Tag()), strconv.FormatBool(behind)
+}
+
+// BuildProvenance returns the source location, commit and Build of the image of the given container, with NA for the
+// missing values, and whether its Build confirms the commit and the image digest. The verification is missing when the
+// Build was pruned, and NA when not verified. The Build is prefixed by its namespace when different from the one of the
+// container
+func BuildProvenance(topologyModel *model.TopologyModel, namespace model.NamespaceModel, applicationConfig model.ApplicationConfig) (string, string, string, string) {
+	applicationImage, ok := topologyModel.ImageByName(applicationConfig.ImageName)
+	if !ok {
+		return "NA", "NA", "NA", "NA"
+	}
+	provenance := model.ImageProvenance(applicationImage, namespace.Name())
+	if provenance.Build.Name == "" {
+		return orNA(provenance.SourceLocation), orNA(provenance.CommitId), "NA", "NA"
+	}
+	buildName := provenance.Build.Name
+	if provenance.Build.Namespace != namespace.Name() {
+		buildName = provenance.Build.Namespace + "/" + buildName
+	}
+	verified := "NA"
+	if build, ok := namespace.BuildOf(provenance.Build); ok {
+		if build == nil {
+			verified = "missing"
+		} else {
+			digest := ImageDigest(applicationConfig)
+			verified = strconv.FormatBool((build.CommitId == "" || provenance.CommitId == "" || build.CommitId == provenance.CommitId) &&
+				(build.ImageDigest == "" || digest == "NA" || build.ImageDigest == digest))
+		}
+	}
+	return orNA(provenance.SourceLocation), orNA(provenance.CommitId), buildName, verified
+}
+
+// ImageCreated returns the creation time of the image of the given container, or the zero time if unknown
+func ImageCreated(topologyModel *model.TopologyModel, applicationConfig model.ApplicationConfig) time.Time {
+	applicationImage, ok := topologyModel.ImageByName(applicationConfig.ImageName)
+	if !ok {
+		return time.Time{}
+	}
+	return applicationImage.ImageCreated()
+}
+
+// ImageAge returns the creation time of the image of the given container, in RFC 3339 format, its age in days at the
+// given time, and whether it is older than the configured stale image age, with NA for the unknown values
+func ImageAge(config *config.Config, topologyModel *model.TopologyModel, applicationConfig model.ApplicationConfig, now time.Time) (string, string, string) {
+	created := ImageCreated(topologyModel, applicationConfig)
+	if created.IsZero() {
+		return "NA", "NA", "NA"
+	}
+	age := now.Sub(created)
+	stale := "NA"
+	if config.StaleImageAge() > 0 {
+		stale = strconv.FormatBool(age > config.StaleImageAge())
+	}
+	return created.UTC().Format(time.RFC3339), strconv.Itoa(int(age.Hours() / 24)), stale
+}
+
+func orNA(value string) string {
+	if value == "" {
+		return "NA"
+	}
+	return value
+}
+
 func appendNewLine(sb *strings.Builder, format string, args ...any) {
 	sb.WriteString(fmt.Sprintf(format+"\n", args...))
 }
@@ -82,22 +279,58 @@ func MemoryUsage(usage k8sCoreV1.ResourceList) string {
 
 func (f Formatter) text(topologyModel *model.TopologyModel) *strings.Builder {
 	var sb = &strings.Builder{}
+	now := time.Now()
+	var staleImages []string
+	mutableTags := MutableTags(f.config, topologyModel)
+	mutableTagSet := MutableTagSet(mutableTags)
 
 	for _, namespace := range SortedNamespaces(topologyModel) {
-		for _, applicationProvider := range namespace.AllApplicationProviders() {
-			appendNewLine(sb, "===============\nNamespace: %s\nApplication: %s (%s)", namespace.Name(), applicationProvider.(model.Resource).Name(), applicationProvider.(model.Resource).Kind())
-			for _, applicationConfig := range applicationProvider.ApplicationConfigs() {
-				appendNewLine(sb, "Container name: %s\n", applicationConfig.ContainerName)
+		for _, applicationProvider := range SortedApplicationProviders(namespace) {
+			kind := applicationProvider.(model.Resource).Kind()
+			if model.IsOrphanProvider(applicationProvider) {
+				kind = fmt.Sprintf("%s, orphan", kind)
+			}
+			appendNewLine(sb, "===============\nCluster: %s\nNamespace: %s\nApplication: %s (%s)\nOwner: %s", namespace.Cluster(), namespace.Name(), applicationProvider.(model.Resource).Name(), kind, Owner(namespace, applicationProvider.(model.Resource)))
+			for _, applicationConfig := range ApplicationConfigs(f.config, namespace, applicationProvider) {
+				appendNewLine(sb, "Container name: %s\nContainer role: %s\n", applicationConfig.ContainerName, applicationConfig.Role)
+				version, versionSource := ImageVersion(f.config, topologyModel, applicationConfig)
 				applicationImage, ok := topologyModel.ImageByName(applicationConfig.ImageName)
 				if ok {
 					appendNewLine(sb, "Image name: %s", applicationImage.ImageName())
-					appendNewLine(sb, "Image version: %s", applicationImage.ImageVersion())
+					appendNewLine(sb, "Image version: %s (%s)", version, versionSource)
 					appendNewLine(sb, "Image full name: %s", applicationImage.ImageFullName())
 				} else {
 					appendNewLine(sb, "Image name: %s", "NA")
-					appendNewLine(sb, "Image version: %s", "NA")
+					appendNewLine(sb, "Image version: %s (%s)", version, versionSource)
 					appendNewLine(sb, "Image full name: %s", applicationConfig.ImageName)
 				}
+				registry, repository, tag := ImageReference(applicationConfig)
+				appendNewLine(sb, "Image registry: %s\nImage repository: %s\nImage tag: %s", registry, repository, tag)
+				if digest := ImageDigest(applicationConfig); digest != "NA" {
+					appendNewLine(sb, "Image digest: %s", digest)
+				}
+				if runningDigest, drift := RunningImageDigest(namespace, applicationProvider.(model.Resource), applicationConfig); runningDigest != "NA" {
+					appendNewLine(sb, "Running image digest: %s\nImage drift: %v", runningDigest, drift)
+				}
+				if stream, streamTag, behind := ImageStreamTag(namespace, applicationProvider.(model.Resource), applicationConfig); stream != "NA" {
+					appendNewLine(sb, "Image stream: %s\nImage stream tag: %s\nBehind image stream tag: %s", stream, streamTag, behind)
+				}
+				if sourceLocation, commit, build, verified := BuildProvenance(topologyModel, namespace, applicationConfig); sourceLocation != "NA" || commit != "NA" || build != "NA" {
+					appendNewLine(sb, "Source location: %s\nCommit: %s\nBuild: %s\nBuild verified: %s", sourceLocation, commit, build, verified)
+				}
+				if created, ageDays, stale := ImageAge(f.config, topologyModel, applicationConfig, now); created != "NA" {
+					appendNewLine(sb, "Image created: %s (%s days ago)\nStale image: %s", created, ageDays, stale)
+					if stale == "true" {
+						staleImages = append(staleImages, fmt.Sprintf("%s/%s/%s, container %s: %s (%s days)", namespace.Cluster(), namespace.Name(),
+							applicationProvider.(model.Resource).Name(), applicationConfig.ContainerName, applicationConfig.ImageName, ageDays))
+					}
+				}
+				if image, ok := topologyModel.ImageByName(applicationConfig.ImageName); ok && image.ImageSize() > 0 {
+					appendNewLine(sb, "Image size: %s", formatSize(image.ImageSize()))
+				}
+				if mutableTag := IsMutableTag(mutableTagSet, applicationConfig); mutableTag != "NA" {
+					appendNewLine(sb, "Mutable tag: %s", mutableTag)
+				}
 				if f.config.WithResources() {
 					res := applicationConfig.Resources
 					appendNewLine(sb, "Limits: %s CPU, %s memory\nRequests: %s CPU, %s memory", CpuLimits(res), MemoryLimits(res), CpuRequests(res), MemoryRequests(res))
@@ -122,29 +355,82 @@ func (f Formatter) text(topologyModel *model.TopologyModel) *strings.Builder {
 			}
 		}
 	}
+	if f.config.StaleImageAge() > 0 {
+		appendNewLine(sb, "===============\nStale images, older than %d days: %d", int(f.config.StaleImageAge().Hours()/24), len(staleImages))
+		for _, staleImage := range staleImages {
+			appendNewLine(sb, "%s", staleImage)
+		}
+	}
+	f.footprintText(sb, topologyModel)
+	if len(mutableTags) > 0 {
+		appendNewLine(sb, "===============\nMutable tags resolving to different digests: %d", len(mutableTags))
+		for _, mutableTag := range mutableTags {
+			appendNewLine(sb, "%s", mutableTag.Tag)
+			for _, digest := range mutableTag.SortedDigests() {
+				for _, location := range mutableTag.Digests[digest] {
+					appendNewLine(sb, "  %s: %s", digest, location)
+				}
+			}
+		}
+	}
 	return sb
 }
 
+// footprintText appends the footprint of the images by namespace and by node, and the largest images, if any size is
+// known
+func (f Formatter) footprintText(sb *strings.Builder, topologyModel *model.TopologyModel) {
+	byNamespace, byNode, largest := ImageFootprints(f.config, topologyModel)
+	if len(largest) == 0 {
+		return
+	}
+	for _, group := range []struct {
+		title      string
+		footprints []*Footprint
+	}{{"namespace", byNamespace}, {"node", byNode}} {
+		appendNewLine(sb, "===============\nImage footprint by %s:", group.title)
+		for _, footprint := range group.footprints {
+			appendNewLine(sb, "%s: %d images, %s on disk, %s of shared layers", footprint.Name, footprint.Images,
+				formatSize(footprint.LayersSize), formatSize(footprint.SharedSize()))
+		}
+	}
+	appendNewLine(sb, "===============\nLargest images:")
+	for _, image := range largest {
+		appendNewLine(sb, "%s: %s", image.Name, formatSize(image.Size))
+	}
+}
+
 func (f Formatter) csv(topologyModel *model.TopologyModel) *strings.Builder {
 	var sb = &strings.Builder{}
+	now := time.Now()
+	mutableTagSet := MutableTagSet(MutableTags(f.config, topologyModel))
 	if f.config.WithResources() {
-		appendNewLine(sb, "namespace, application, container, imageName, imageVersion, fullImageName, CPU limits, memory limits, CPU requests, memory requests, pod, CPU usage, memory usage")
+		appendNewLine(sb, "cluster, namespace, application, orphan, owner, container, containerRole, imageName, imageVersion, versionSource, fullImageName, registry, repository, tag, imageDigest, runningImageDigest, drift, imageStream, imageStreamTag, behind, sourceLocation, commit, build, buildVerified, imageCreated, imageAgeDays, stale, imageSize, mutableTag, CPU limits, memory limits, CPU requests, memory requests, pod, CPU usage, memory usage")
 	} else {
-		appendNewLine(sb, "namespace, application, container, imageName, imageVersion, fullImageName")
+		appendNewLine(sb, "cluster, namespace, application, orphan, owner, container, containerRole, imageName, imageVersion, versionSource, fullImageName, registry, repository, tag, imageDigest, runningImageDigest, drift, imageStream, imageStreamTag, behind, sourceLocation, commit, build, buildVerified, imageCreated, imageAgeDays, stale, imageSize, mutableTag")
 	}
 
 	for _, namespace := range SortedNamespaces(topologyModel) {
-		for _, applicationProvider := range namespace.AllApplicationProviders() {
+		for _, applicationProvider := range SortedApplicationProviders(namespace) {
 			logger.Debugf("## %s %s", applicationProvider.(model.Resource).Kind(), applicationProvider.(model.Resource).Name())
-			for _, applicationConfig := range applicationProvider.ApplicationConfigs() {
+			for _, applicationConfig := range ApplicationConfigs(f.config, namespace, applicationProvider) {
 				var record []string
-				record = append(record, namespace.Name(), applicationProvider.(model.Resource).Name(), applicationConfig.ContainerName)
+				record = append(record, namespace.Cluster(), namespace.Name(), applicationProvider.(model.Resource).Name(), strconv.FormatBool(model.IsOrphanProvider(applicationProvider)), Owner(namespace, applicationProvider.(model.Resource)), applicationConfig.ContainerName, applicationConfig.Role.String())
+				version, versionSource := ImageVersion(f.config, topologyModel, applicationConfig)
 				applicationImage, ok := topologyModel.ImageByName(applicationConfig.ImageName)
 				if ok {
-					record = append(record, applicationImage.ImageName(), applicationImage.ImageVersion(), applicationImage.ImageFullName())
+					record = append(record, applicationImage.ImageName(), version, versionSource, applicationImage.ImageFullName())
 				} else {
-					record = append(record, applicationConfig.ImageName, "NA", applicationConfig.ImageName)
+					record = append(record, applicationConfig.ImageName, version, versionSource, applicationConfig.ImageName)
 				}
+				registry, repository, tag := ImageReference(applicationConfig)
+				runningDigest, drift := RunningImageDigest(namespace, applicationProvider.(model.Resource), applicationConfig)
+				record = append(record, registry, repository, tag, ImageDigest(applicationConfig), runningDigest, strconv.FormatBool(drift))
+				stream, streamTag, behind := ImageStreamTag(namespace, applicationProvider.(model.Resource), applicationConfig)
+				record = append(record, stream, streamTag, behind)
+				sourceLocation, commit, build, verified := BuildProvenance(topologyModel, namespace, applicationConfig)
+				record = append(record, sourceLocation, commit, build, verified)
+				created, ageDays, stale := ImageAge(f.config, topologyModel, applicationConfig, now)
+				record = append(record, created, ageDays, stale, ImageSize(topologyModel, applicationConfig), IsMutableTag(mutableTagSet, applicationConfig))
 				if f.config.WithResources() {
 					res := applicationConfig.Resources
 					record = append(record, CpuLimits(res), MemoryLimits(res), CpuRequests(res), MemoryRequests(res))
@@ -0,0 +1,352 @@
+package formatter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dmartinol/application-exporter/pkg/config"
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	"github.com/dmartinol/application-exporter/pkg/model"
+	k8sAppsV1 "k8s.io/api/apps/v1"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	benchmarkDeployments       = 500
+	benchmarkPodsPerDeployment = 10
+)
+
+func init() {
+	logger.InitLogger(false, "warn")
+}
+
+// syntheticTopology returns a single namespace with benchmarkDeployments Deployments, each one owning a ReplicaSet
+// with benchmarkPodsPerDeployment running Pods
+func syntheticTopology() *model.TopologyModel {
+	topology := model.NewTopologyModel()
+	namespace := topology.AddNamespace("benchmark")
+
+	var pods []model.Pod
+	for d := 0; d < benchmarkDeployments; d++ {
+		name := fmt.Sprintf("app-%d", d)
+		deployment := k8sAppsV1.Deployment{ObjectMeta: k8sMetaV1.ObjectMeta{Name: name, UID: k8sTypes.UID(name)}}
+		for _, container := range []string{"main", "proxy"} {
+			deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers,
+				k8sCoreV1.Container{Name: container, Image: fmt.Sprintf("quay.io/benchmark/%s-%s:1.0", name, container)})
+		}
+		namespace.AddResource(model.Deployment{Delegate: deployment})
+
+		replicaSetName := fmt.Sprintf("%s-5d9f8c7b6", name)
+		replicaSet := k8sAppsV1.ReplicaSet{ObjectMeta: k8sMetaV1.ObjectMeta{Name: replicaSetName, UID: k8sTypes.UID(replicaSetName),
+			OwnerReferences: []k8sMetaV1.OwnerReference{model.ControllerReference("Deployment", name, deployment.UID)}}}
+		namespace.AddResource(model.ReplicaSet{Delegate: replicaSet})
+
+		for p := 0; p < benchmarkPodsPerDeployment; p++ {
+			podName := fmt.Sprintf("%s-%d", replicaSetName, p)
+			pod := k8sCoreV1.Pod{ObjectMeta: k8sMetaV1.ObjectMeta{Name: podName, UID: k8sTypes.UID(podName),
+				OwnerReferences: []k8sMetaV1.OwnerReference{model.ControllerReference("ReplicaSet", replicaSetName, replicaSet.UID)}}}
+			pod.Status.Phase = k8sCoreV1.PodRunning
+			pods = append(pods, model.Pod{Delegate: pod})
+		}
+	}
+	for _, pod := range pods {
+		namespace.AddResource(pod)
+	}
+	return topology
+}
+
+func BenchmarkBuildNamespace(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		syntheticTopology()
+	}
+}
+
+func benchmarkFormat(b *testing.B, contentType config.ContentType) {
+	topology := syntheticTopology()
+	cfg := &config.Config{}
+	cfg.SetContentType(contentType)
+	cfg.SetWithResources(true)
+	formatter := NewFormatterForConfig(cfg)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		formatter.Format(topology)
+	}
+}
+
+func BenchmarkFormatText(b *testing.B) {
+	benchmarkFormat(b, config.Text)
+}
+
+func BenchmarkFormatCSV(b *testing.B) {
+	benchmarkFormat(b, config.CSV)
+}
+
+func TestImageAge(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	topology := model.NewTopologyModel()
+	for imageName, created := range map[string]time.Time{
+		"quay.io/test/old:1.0":    now.Add(-120 * 24 * time.Hour),
+		"quay.io/test/recent:1.0": now.Add(-10 * 24 * time.Hour),
+	} {
+		topology.AddImage(imageName, &model.Image{FullName: imageName, Config: &model.ImageConfig{Created: created}})
+	}
+	topology.AddImage("quay.io/test/unknown:1.0", model.NewImageByRegistry("quay.io/test/unknown:1.0"))
+	cfg := &config.Config{}
+	cfg.SetStaleImageAge(config.DefaultStaleImageAge)
+
+	tests := []struct {
+		imageName string
+		created   string
+		ageDays   string
+		stale     string
+	}{
+		{"quay.io/test/old:1.0", "2022-06-03T12:00:00Z", "120", "true"},
+		{"quay.io/test/recent:1.0", "2022-09-21T12:00:00Z", "10", "false"},
+		{"quay.io/test/unknown:1.0", "NA", "NA", "NA"},
+	}
+	for _, test := range tests {
+		created, ageDays, stale := ImageAge(cfg, topology, model.ApplicationConfig{ImageName: test.imageName}, now)
+		if created != test.created || ageDays != test.ageDays || stale != test.stale {
+			t.Errorf("Expected %s %s %s for %s, got %s %s %s", test.created, test.ageDays, test.stale, test.imageName, created, ageDays, stale)
+		}
+	}
+}
+
+func TestImageFootprints(t *testing.T) {
+	topology := model.NewTopologyModel()
+	namespace := topology.AddNamespace("app")
+	baseLayer := model.ImageLayer{Digest: "sha256:base", Size: 100}
+	for name, layer := range map[string]model.ImageLayer{"web": {Digest: "sha256:web", Size: 50}, "api": {Digest: "sha256:api", Size: 30}} {
+		imageName := fmt.Sprintf("quay.io/test/%s:1.0", name)
+		topology.AddImage(imageName, &model.Image{FullName: imageName, Config: &model.ImageConfig{Layers: []model.ImageLayer{baseLayer, layer}}})
+		deployment := k8sAppsV1.Deployment{ObjectMeta: k8sMetaV1.ObjectMeta{Name: name, UID: k8sTypes.UID(name)}}
+		deployment.Spec.Template.Spec.Containers = []k8sCoreV1.Container{{Name: "main", Image: imageName}}
+		namespace.AddResource(model.Deployment{Delegate: deployment})
+	}
+	for podName, nodeName := range map[string]string{"web-0": "node-a", "api-0": "node-a", "api-1": "node-b"} {
+		owner := podName[:3]
+		pod := k8sCoreV1.Pod{ObjectMeta: k8sMetaV1.ObjectMeta{Name: podName, UID: k8sTypes.UID(podName),
+			OwnerReferences: []k8sMetaV1.OwnerReference{model.ControllerReference("Deployment", owner, k8sTypes.UID(owner))}}}
+		pod.Spec.NodeName = nodeName
+		pod.Status.Phase = k8sCoreV1.PodRunning
+		namespace.AddResource(model.Pod{Delegate: pod})
+	}
+
+	byNamespace, byNode, largest := ImageFootprints(&config.Config{}, topology)
+	if len(byNamespace) != 1 || byNamespace[0].Images != 2 || byNamespace[0].Size != 280 || byNamespace[0].LayersSize != 180 || byNamespace[0].SharedSize() != 100 {
+		t.Errorf("Unexpected footprint by namespace %+v", byNamespace)
+	}
+	if len(byNode) != 2 || byNode[0].Name != "/node-a" || byNode[0].LayersSize != 180 || byNode[1].Name != "/node-b" || byNode[1].LayersSize != 130 || byNode[1].SharedSize() != 0 {
+		t.Errorf("Unexpected footprint by node %+v", byNode)
+	}
+	if len(largest) != 2 || largest[0].Name != "quay.io/test/web:1.0" || largest[0].Size != 150 {
+		t.Errorf("Unexpected largest images %+v", largest)
+	}
+	if size := formatSize(5 * 1024 * 1024 / 2); size != "2.5MiB" {
+		t.Errorf("Unexpected formatted size %s", size)
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	tests := []struct {
+		imageName string
+		tag       string
+		tagged    bool
+	}{
+		{"quay.io/team/app:1.0", "quay.io/team/app:1.0", true},
+		{"quay.io/team/app", "quay.io/team/app:latest", true},
+		{"nginx", "docker.io/library/nginx:latest", true},
+		{"quay.io/team/app:1.0@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "quay.io/team/app:1.0", true},
+		{"quay.io/team/app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "", false},
+	}
+	for _, test := range tests {
+		tag, tagged := ImageTag(model.ApplicationConfig{ImageName: test.imageName})
+		if tag != test.tag || tagged != test.tagged {
+			t.Errorf("Expected %s %t for %s, got %s %t", test.tag, test.tagged, test.imageName, tag, tagged)
+		}
+	}
+}
+
+const (
+	testDigest  = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	otherDigest = "sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+)
+
+// addDeployment adds a Deployment running the given image in its main container
+func addDeployment(namespace *model.NamespaceModel, name string, imageName string) model.Resource {
+	deployment := k8sAppsV1.Deployment{ObjectMeta: k8sMetaV1.ObjectMeta{Namespace: namespace.Name(), Name: name, UID: k8sTypes.UID(name)}}
+	deployment.Spec.Template.Spec.Containers = []k8sCoreV1.Container{{Name: "main", Image: imageName}}
+	resource := model.Deployment{Delegate: deployment}
+	namespace.AddResource(resource)
+	return resource
+}
+
+// addPod adds a Pod of the given owner whose main container runs the given image ID, unless empty
+func addPod(namespace *model.NamespaceModel, name string, owner model.Resource, imageID string) {
+	pod := k8sCoreV1.Pod{ObjectMeta: k8sMetaV1.ObjectMeta{Namespace: namespace.Name(), Name: name, UID: k8sTypes.UID(name),
+		OwnerReferences: []k8sMetaV1.OwnerReference{model.ControllerReference(owner.Kind(), owner.Name(), owner.UID())}}}
+	if imageID != "" {
+		pod.Status.ContainerStatuses = []k8sCoreV1.ContainerStatus{{Name: "main", ImageID: imageID}}
+	}
+	namespace.AddResource(model.Pod{Delegate: pod})
+}
+
+func TestRunningImageDigest(t *testing.T) {
+	namespace := model.NewTopologyModel().AddNamespace("app")
+	drifting := addDeployment(namespace, "billing-api", "quay.io/test/billing-api:latest")
+	pinned := addDeployment(namespace, "billing-ui", "quay.io/test/billing-ui@"+testDigest)
+	stable := addDeployment(namespace, "cart", "quay.io/test/cart@"+testDigest)
+	idle := addDeployment(namespace, "api", "quay.io/test/api:1.0")
+	addPod(namespace, "billing-api-0", drifting, "docker-pullable://quay.io/test/billing-api@"+testDigest)
+	addPod(namespace, "billing-api-1", drifting, "quay.io/test/billing-api@"+otherDigest)
+	// Images built on the node have no registry digest
+	addPod(namespace, "billing-api-2", drifting, "sha256:local")
+	addPod(namespace, "billing-ui-0", pinned, "quay.io/test/billing-ui@"+otherDigest)
+	addPod(namespace, "cart-0", stable, "quay.io/test/cart@"+testDigest)
+	addPod(namespace, "api-0", idle, "")
+
+	tests := []struct {
+		application model.Resource
+		digests     string
+		drift       bool
+	}{
+		{drifting, testDigest + " " + otherDigest, true},
+		{pinned, otherDigest, true},
+		{stable, testDigest, false},
+		{idle, "NA", false},
+	}
+	for _, test := range tests {
+		applicationConfig := test.application.(model.ApplicationProvider).ApplicationConfigs()[0]
+		digests, drift := RunningImageDigest(*namespace, test.application, applicationConfig)
+		if digests != test.digests || drift != test.drift {
+			t.Errorf("Expected digests %s drift %t for %s, got %s %t", test.digests, test.drift, test.application.Name(), digests, drift)
+		}
+	}
+}
+
+func TestImageStreamTag(t *testing.T) {
+	namespace := model.NewTopologyModel().AddNamespace("app")
+	registry := "image-registry.openshift-image-registry.svc:5000/"
+	web := addDeployment(namespace, "web", registry+"app/web:latest")
+	addPod(namespace, "web-0", web, registry+"app/web@"+testDigest)
+	worker := addDeployment(namespace, "worker", registry+"shared/base@"+otherDigest)
+	idle := addDeployment(namespace, "idle", registry+"app/idle:latest")
+	unresolved := addDeployment(namespace, "unresolved", registry+"app/unresolved@"+testDigest)
+	api := addDeployment(namespace, "api", "quay.io/test/api:1.0")
+	namespace.AddLatestImage(model.ImageTrigger{Namespace: "app", Name: "web:latest"}, otherDigest)
+	namespace.AddLatestImage(model.ImageTrigger{Namespace: "shared", Name: "base:stable"}, otherDigest)
+	namespace.AddLatestImage(model.ImageTrigger{Namespace: "app", Name: "idle:latest"}, otherDigest)
+
+	tests := []struct {
+		application         model.Resource
+		trigger             *model.ImageTrigger
+		stream, tag, behind string
+	}{
+		{web, &model.ImageTrigger{Namespace: "app", Name: "web:latest"}, "web", "latest", "true"},
+		{worker, &model.ImageTrigger{Namespace: "shared", Name: "base:stable"}, "shared/base", "stable", "false"},
+		// Neither an image digest nor running pods to compare with the latest image
+		{idle, &model.ImageTrigger{Namespace: "app", Name: "idle:latest"}, "idle", "latest", "NA"},
+		{unresolved, &model.ImageTrigger{Namespace: "app", Name: "unresolved:latest"}, "unresolved", "latest", "NA"},
+		{api, nil, "NA", "NA", "NA"},
+	}
+	for _, test := range tests {
+		applicationConfig := test.application.(model.ApplicationProvider).ApplicationConfigs()[0]
+		applicationConfig.ImageTrigger = test.trigger
+		stream, tag, behind := ImageStreamTag(*namespace, test.application, applicationConfig)
+		if stream != test.stream || tag != test.tag || behind != test.behind {
+			t.Errorf("Expected %s:%s behind=%s for %s, got %s:%s behind=%s", test.stream, test.tag, test.behind,
+				test.application.Name(), stream, tag, behind)
+		}
+	}
+}
+
+func TestBuildProvenance(t *testing.T) {
+	topology := model.NewTopologyModel()
+	namespace := topology.AddNamespace("app")
+	for imageName, labels := range map[string]map[string]string{
+		"legacy@" + testDigest: {model.BuildCommitIdLabel: "4f2c1d0", model.BuildSourceLocationLabel: "https://github.com/team/legacy.git",
+			model.BuildNameLabel: "legacy-3"},
+		"rebuilt@" + testDigest:   {model.BuildCommitIdLabel: "4f2c1d0", model.BuildNameLabel: "rebuilt-2"},
+		"pruned@" + otherDigest:   {model.BuildCommitIdLabel: "9e8d7c6", model.BuildNameLabel: "pruned-1", model.BuildNamespaceLabel: "ci"},
+		"unloaded@" + otherDigest: {model.BuildCommitIdLabel: "9e8d7c6", model.BuildNameLabel: "unloaded-1"},
+		"oci:1.0":                 {model.OCIRevisionLabel: "1a2b3c4", model.OCISourceLabel: "https://github.com/team/oci"},
+	} {
+		topology.AddImage("quay.io/test/"+imageName, &model.Image{FullName: "quay.io/test/" + imageName, Config: &model.ImageConfig{Labels: labels}})
+	}
+	namespace.AddBuild(model.BuildReference{Namespace: "app", Name: "legacy-3"},
+		&model.Build{SourceLocation: "https://github.com/team/legacy.git", CommitId: "4f2c1d0", ImageDigest: testDigest})
+	namespace.AddBuild(model.BuildReference{Namespace: "app", Name: "rebuilt-2"}, &model.Build{CommitId: "4f2c1d0", ImageDigest: otherDigest})
+	namespace.AddBuild(model.BuildReference{Namespace: "ci", Name: "pruned-1"}, nil)
+
+	tests := []struct {
+		imageName                               string
+		sourceLocation, commit, build, verified string
+	}{
+		{"legacy@" + testDigest, "https://github.com/team/legacy.git", "4f2c1d0", "legacy-3", "true"},
+		{"rebuilt@" + testDigest, "NA", "4f2c1d0", "rebuilt-2", "false"},
+		{"pruned@" + otherDigest, "NA", "9e8d7c6", "ci/pruned-1", "missing"},
+		{"unloaded@" + otherDigest, "NA", "9e8d7c6", "unloaded-1", "NA"},
+		{"oci:1.0", "https://github.com/team/oci", "1a2b3c4", "NA", "NA"},
+		{"unknown:1.0", "NA", "NA", "NA", "NA"},
+	}
+	for _, test := range tests {
+		sourceLocation, commit, build, verified := BuildProvenance(topology, *namespace, model.ApplicationConfig{ImageName: "quay.io/test/" + test.imageName})
+		if sourceLocation != test.sourceLocation || commit != test.commit || build != test.build || verified != test.verified {
+			t.Errorf("Unexpected provenance of %s: %s %s %s %s", test.imageName, sourceLocation, commit, build, verified)
+		}
+	}
+}
+
+func TestMutableTags(t *testing.T) {
+	topology := model.NewTopologyModel()
+	for namespaceName, digests := range map[string]map[string]string{
+		"ns-0": {"shop": testDigest, "cart": testDigest},
+		"ns-1": {"shop": otherDigest, "cart": testDigest},
+	} {
+		namespace := topology.AddNamespace(namespaceName)
+		for name, digest := range digests {
+			tag := map[string]string{"shop": "latest", "cart": "2.0"}[name]
+			deployment := addDeployment(namespace, name, fmt.Sprintf("quay.io/test/%s:%s", name, tag))
+			addPod(namespace, name+"-0", deployment, "quay.io/test/"+name+"@"+digest)
+		}
+	}
+	// The latest image of the ImageStreamTag of a trigger is another location of the tag
+	namespace := topology.AddNamespace("ns-2")
+	web := k8sAppsV1.Deployment{ObjectMeta: k8sMetaV1.ObjectMeta{Namespace: "ns-2", Name: "web", UID: "web", Annotations: map[string]string{
+		model.ImageTriggersAnnotation: `[{"from":{"kind":"ImageStreamTag","name":"web:latest"},"fieldPath":"spec.template.spec.containers[?(@.name==\"main\")].image"}]`}}}
+	web.Spec.Template.Spec.Containers = []k8sCoreV1.Container{{Name: "main", Image: "image-registry.openshift-image-registry.svc:5000/ns-2/web:latest"}}
+	namespace.AddResource(model.Deployment{Delegate: web})
+	addPod(namespace, "web-0", model.Deployment{Delegate: web}, "image-registry.openshift-image-registry.svc:5000/ns-2/web@"+testDigest)
+	namespace.AddLatestImage(model.ImageTrigger{Namespace: "ns-2", Name: "web:latest"}, otherDigest)
+	pinned := addDeployment(namespace, "pinned", "quay.io/test/pinned@"+testDigest)
+	addPod(namespace, "pinned-0", pinned, "quay.io/test/pinned@"+testDigest)
+
+	mutableTags := MutableTags(&config.Config{}, topology)
+	if len(mutableTags) != 2 || mutableTags[0].Tag != "image-registry.openshift-image-registry.svc:5000/ns-2/web:latest" ||
+		mutableTags[1].Tag != "quay.io/test/shop:latest" {
+		t.Fatalf("Expected the web:latest and shop:latest mutable tags, got %+v", mutableTags)
+	}
+	if digests := mutableTags[0].SortedDigests(); len(digests) != 2 || mutableTags[0].Digests[otherDigest][0] != "/ns-2, ImageStreamTag web:latest" {
+		t.Errorf("Unexpected digests of web:latest %+v", mutableTags[0].Digests)
+	}
+	if digests := mutableTags[1].SortedDigests(); len(digests) != 2 || mutableTags[1].Digests[otherDigest][0] != "/ns-1/shop-0, container main" {
+		t.Errorf("Unexpected digests of shop:latest %+v", mutableTags[1].Digests)
+	}
+	tests := []struct {
+		namespace, name, mutableTag string
+	}{
+		{"ns-0", "shop", "true"},
+		{"ns-0", "cart", "false"},
+		{"ns-2", "pinned", "NA"},
+	}
+	for _, test := range tests {
+		applicationConfig := topology.NamespaceByName(test.namespace).LookupByKindAndName("Deployment", test.name).(model.ApplicationProvider).ApplicationConfigs()[0]
+		if mutableTag := IsMutableTag(MutableTagSet(mutableTags), applicationConfig); mutableTag != test.mutableTag {
+			t.Errorf("Expected mutable tag %s for %s, got %s", test.mutableTag, test.name, mutableTag)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package formatter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/dmartinol/application-exporter/pkg/config"
+	"github.com/dmartinol/application-exporter/pkg/model"
+)
+
+// MutableTag is an image tag resolving to different digests, with the locations of every digest, like the pods running
+// it or the ImageStreamTag pointing to it
+type MutableTag struct {
+	Tag     string
+	Digests map[string][]string
+}
+
+// SortedDigests returns the digests of the tag, sorted
+func (m MutableTag) SortedDigests() []string {
+	var digests []string
+	for digest := range m.Digests {
+		digests = append(digests, digest)
+	}
+	sort.Strings(digests)
+	return digests
+}
+
+// ImageTag returns the normalized tagged reference of the image of the given container, like
+// quay.io/team/app:latest, or false if the image is only referenced by digest. The tag defaults to latest, as pulled by
+// the container runtime when the image has neither a tag nor a digest
+func ImageTag(applicationConfig model.ApplicationConfig) (string, bool) {
+	ref, ok := applicationConfig.ImageReference()
+	if !ok || (ref.Tag == "" && ref.Digest != "") {
+		return "", false
+	}
+	tag := ref.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	return ref.Registry + "/" + ref.Repository + ":" + tag, true
+}
+
+// MutableTags returns the image tags of the collected containers resolving to different digests, sorted by tag. The
+// digests are those of the running pods, and of the ImageStreamTags of the image triggers
+func MutableTags(config *config.Config, topologyModel *model.TopologyModel) []MutableTag {
+	locations := make(map[string]map[string]map[string]bool)
+	addLocation := func(tag string, digest string, location string) {
+		if locations[tag] == nil {
+			locations[tag] = make(map[string]map[string]bool)
+		}
+		if locations[tag][digest] == nil {
+			locations[tag][digest] = make(map[string]bool)
+		}
+		locations[tag][digest][location] = true
+	}
+
+	for _, namespace := range SortedNamespaces(topologyModel) {
+		for _, applicationProvider := range namespace.AllApplicationProviders() {
+			for _, applicationConfig := range ApplicationConfigs(config, namespace, applicationProvider) {
+				tag, ok := ImageTag(applicationConfig)
+				if !ok {
+					continue
+				}
+				for _, pod := range namespace.AllPodsOf(applicationProvider.(model.Resource)) {
+					if digest := pod.RunningImageDigest(applicationConfig.ContainerName); digest != "" {
+						addLocation(tag, digest, fmt.Sprintf("%s/%s/%s, container %s", namespace.Cluster(), namespace.Name(), pod.Name(), applicationConfig.ContainerName))
+					}
+				}
+				if trigger := applicationConfig.ImageTrigger; trigger != nil {
+					if digest, ok := namespace.LatestImageOf(*trigger); ok {
+						addLocation(tag, digest, fmt.Sprintf("%s/%s, ImageStreamTag %s", namespace.Cluster(), trigger.Namespace, trigger.Name))
+					}
+				}
+			}
+		}
+	}
+
+	var mutableTags []MutableTag
+	for tag, digests := range locations {
+		if len(digests) < 2 {
+			continue
+		}
+		mutableTag := MutableTag{Tag: tag, Digests: make(map[string][]string)}
+		for digest, digestLocations := range digests {
+			for location := range digestLocations {
+				mutableTag.Digests[digest] = append(mutableTag.Digests[digest], location)
+			}
+			sort.Strings(mutableTag.Digests[digest])
+		}
+		mutableTags = append(mutableTags, mutableTag)
+	}
+	sort.Slice(mutableTags, func(i, j int) bool {
+		return mutableTags[i].Tag < mutableTags[j].Tag
+	})
+	return mutableTags
+}
+
+// MutableTagSet returns the tags of the given MutableTags, to flag the containers using them
+func MutableTagSet(mutableTags []MutableTag) map[string]bool {
+	tags := make(map[string]bool, len(mutableTags))
+	for _, mutableTag := range mutableTags {
+		tags[mutableTag.Tag] = true
+	}
+	return tags
+}
+
+// IsMutableTag returns whether the image tag of the given container is among the given mutable tags, or NA if the image
+// is not tagged
+func IsMutableTag(mutableTags map[string]bool, applicationConfig model.ApplicationConfig) string {
+	tag, ok := ImageTag(applicationConfig)
+	if !ok {
+		return "NA"
+	}
+	return strconv.FormatBool(mutableTags[tag])
+}
@@ -1,21 +1,111 @@
 package model
 
 import (
-	"strings"
-
 	k8sCoreV1 "k8s.io/api/core/v1"
 )
 
+// DefaultContainerAnnotation is the annotation used by kubectl to select the main container of a pod
+const DefaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+type ContainerRole int64
+
+const (
+	MainContainer ContainerRole = iota
+	InitContainer
+	SidecarContainer
+	EphemeralContainer
+)
+
+func (r ContainerRole) String() string {
+	switch r {
+	case MainContainer:
+		return "main"
+	case InitContainer:
+		return "init"
+	case SidecarContainer:
+		return "sidecar"
+	case EphemeralContainer:
+		return "ephemeral"
+	}
+	return "unknown"
+}
+
 type ApplicationConfig struct {
 	ContainerName  string
+	Role           ContainerRole
 	ImageName      string
+	ImageDigest    string
+	Env            []k8sCoreV1.EnvVar
 	Resources      k8sCoreV1.ResourceRequirements
 	ResourcesUsage k8sCoreV1.ResourceList
+
+	// ImageTrigger is the ImageStreamTag deploying the image, if any
+	ImageTrigger *ImageTrigger
+
+	// ServiceAccountName and ImagePullSecrets of the pod template, to pull the image from the registry
+	ServiceAccountName string
+	ImagePullSecrets   []string
 }
 
+// ImageReference returns the parsed image reference, or false if the image name is not a valid reference
+func (a ApplicationConfig) ImageReference() (ImageReference, bool) {
+	ref, err := ParseImageReference(a.ImageName)
+	return ref, err == nil
+}
+
+// IsImageStream returns true if the image is referenced by digest, like the images of the ImageStreams
 func (a ApplicationConfig) IsImageStream() bool {
-	return strings.Contains(a.ImageName, "@sha")
+	ref, ok := a.ImageReference()
+	return ok && ref.Digest != ""
 }
+
+// ImageStreamId returns the name of the ImageStreamImage, like app@sha256:...
 func (a ApplicationConfig) ImageStreamId() string {
-	return a.ImageName[strings.LastIndex(a.ImageName, "/")+1:]
+	ref, _ := a.ImageReference()
+	return ref.Name() + "@" + ref.Digest
+}
+
+// applicationConfigsOf returns the configuration of all the containers in the given pod template. The init containers
+// restarted like regular ones, e.g. the native sidecars, are sidecars. When the DefaultContainerAnnotation selects the
+// main container, the other regular containers are sidecars, otherwise all of them are main containers.
+// Pod templates have no ephemeral containers, which are only added to running pods: see ephemeralConfigsOf
+func applicationConfigsOf(template k8sCoreV1.PodTemplateSpec) []ApplicationConfig {
+	var apps []ApplicationConfig
+	mainContainer, withMainContainer := template.Annotations[DefaultContainerAnnotation]
+	for _, c := range template.Spec.InitContainers {
+		role := InitContainer
+		if c.RestartPolicy != nil && *c.RestartPolicy == k8sCoreV1.ContainerRestartPolicyAlways {
+			role = SidecarContainer
+		}
+		apps = append(apps, ApplicationConfig{ContainerName: c.Name, Role: role, ImageName: c.Image, Env: c.Env, Resources: c.Resources})
+	}
+	for _, c := range template.Spec.Containers {
+		role := MainContainer
+		if withMainContainer && c.Name != mainContainer {
+			role = SidecarContainer
+		}
+		apps = append(apps, ApplicationConfig{ContainerName: c.Name, Role: role, ImageName: c.Image, Env: c.Env, Resources: c.Resources})
+	}
+	return withPullCredentials(apps, template.Spec)
+}
+
+// ephemeralConfigsOf returns the configuration of the ephemeral containers of the given pod, like those added by kubectl
+// debug
+func ephemeralConfigsOf(pod k8sCoreV1.Pod) []ApplicationConfig {
+	var apps []ApplicationConfig
+	for _, c := range pod.Spec.EphemeralContainers {
+		apps = append(apps, ApplicationConfig{ContainerName: c.Name, Role: EphemeralContainer, ImageName: c.Image, Env: c.Env, Resources: c.Resources})
+	}
+	return withPullCredentials(apps, pod.Spec)
+}
+
+// withPullCredentials sets the ServiceAccountName and ImagePullSecrets of the given pod spec to all the given containers
+func withPullCredentials(apps []ApplicationConfig, spec k8sCoreV1.PodSpec) []ApplicationConfig {
+	for i := range apps {
+		apps[i].ServiceAccountName = spec.ServiceAccountName
+		for _, secret := range spec.ImagePullSecrets {
+			apps[i].ImagePullSecrets = append(apps[i].ImagePullSecrets, secret.Name)
+		}
+	}
+	return apps
 }
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"testing"
+
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	k8sAppsV1 "k8s.io/api/apps/v1"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+)
+
+func init() {
+	logger.InitLogger(false, "warn")
+}
+
+func TestApplicationConfigRoles(t *testing.T) {
+	always := k8sCoreV1.ContainerRestartPolicyAlways
+	spec := k8sCoreV1.PodSpec{
+		InitContainers: []k8sCoreV1.Container{{Name: "migrate"}, {Name: "proxy", RestartPolicy: &always}},
+		Containers:     []k8sCoreV1.Container{{Name: "api"}, {Name: "worker"}},
+	}
+
+	tests := []struct {
+		annotations map[string]string
+		roles       map[string]ContainerRole
+	}{
+		{nil, map[string]ContainerRole{"migrate": InitContainer, "proxy": SidecarContainer, "api": MainContainer, "worker": MainContainer}},
+		{map[string]string{DefaultContainerAnnotation: "worker"}, map[string]ContainerRole{"migrate": InitContainer, "proxy": SidecarContainer, "api": SidecarContainer, "worker": MainContainer}},
+	}
+	for _, test := range tests {
+		template := k8sCoreV1.PodTemplateSpec{Spec: spec}
+		template.Annotations = test.annotations
+		applicationConfigs := applicationConfigsOf(template)
+		if len(applicationConfigs) != len(test.roles) {
+			t.Fatalf("Expected %d containers, got %d", len(test.roles), len(applicationConfigs))
+		}
+		for _, applicationConfig := range applicationConfigs {
+			if role := test.roles[applicationConfig.ContainerName]; applicationConfig.Role != role {
+				t.Errorf("Expected role %s for %s with annotations %v, got %s", role, applicationConfig.ContainerName, test.annotations, applicationConfig.Role)
+			}
+		}
+	}
+}
+
+func debuggedPod(name string, owner Resource, debuggers ...string) Pod {
+	pod := k8sCoreV1.Pod{ObjectMeta: k8sMetaV1.ObjectMeta{Name: name, UID: k8sTypes.UID(name)}}
+	if owner != nil {
+		pod.OwnerReferences = []k8sMetaV1.OwnerReference{ControllerReference(owner.Kind(), owner.Name(), owner.UID())}
+	}
+	pod.Spec.Containers = []k8sCoreV1.Container{{Name: "api", Image: "quay.io/team/api:1.0"}}
+	for _, debugger := range debuggers {
+		pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, k8sCoreV1.EphemeralContainer{
+			EphemeralContainerCommon: k8sCoreV1.EphemeralContainerCommon{Name: debugger, Image: "busybox:1.36"}})
+	}
+	return Pod{Delegate: pod}
+}
+
+func TestEphemeralContainers(t *testing.T) {
+	namespace := NewNamespaceModel("", "app")
+	deployment := Deployment{Delegate: k8sAppsV1.Deployment{ObjectMeta: k8sMetaV1.ObjectMeta{Name: "api", UID: "api"}}}
+	deployment.Delegate.Spec.Template.Spec.Containers = []k8sCoreV1.Container{{Name: "api", Image: "quay.io/team/api:1.0"}}
+	replicaSet := ReplicaSet{Delegate: k8sAppsV1.ReplicaSet{ObjectMeta: k8sMetaV1.ObjectMeta{Name: "api-5d9f8c7b6", UID: "api-5d9f8c7b6",
+		OwnerReferences: []k8sMetaV1.OwnerReference{ControllerReference(deployment.Kind(), deployment.Name(), deployment.UID())}}}}
+	orphan := debuggedPod("debugged", nil, "debugger-x7k2p")
+	for _, resource := range []Resource{deployment, replicaSet, debuggedPod("api-5d9f8c7b6-a", replicaSet, "debugger-q9w8e"),
+		debuggedPod("api-5d9f8c7b6-b", replicaSet, "debugger-q9w8e", "debugger-m3n4b"), debuggedPod("api-5d9f8c7b6-c", replicaSet), orphan} {
+		namespace.AddResource(resource)
+	}
+
+	if applicationConfigs := deployment.ApplicationConfigs(); len(applicationConfigs) != 1 {
+		t.Errorf("Expected only the container of the template of the Deployment, got %d", len(applicationConfigs))
+	}
+	tests := []struct {
+		applicationProvider ApplicationProvider
+		roles               map[string]ContainerRole
+	}{
+		{deployment, map[string]ContainerRole{"api": MainContainer, "debugger-q9w8e": EphemeralContainer, "debugger-m3n4b": EphemeralContainer}},
+		{orphan, map[string]ContainerRole{"api": MainContainer, "debugger-x7k2p": EphemeralContainer}},
+	}
+	for _, test := range tests {
+		name := test.applicationProvider.(Resource).Name()
+		applicationConfigs := namespace.ApplicationConfigsOf(test.applicationProvider)
+		if len(applicationConfigs) != len(test.roles) {
+			t.Fatalf("Expected %d containers for %s, got %d", len(test.roles), name, len(applicationConfigs))
+		}
+		for _, applicationConfig := range applicationConfigs {
+			if role, ok := test.roles[applicationConfig.ContainerName]; !ok || applicationConfig.Role != role {
+				t.Errorf("Expected role %s for %s of %s, got %s", role, applicationConfig.ContainerName, name, applicationConfig.Role)
+			}
+		}
+	}
+}
@@ -2,10 +2,10 @@ package model
 
 import (
 	"fmt"
-	"strings"
 
 	k8sBatchV1 "k8s.io/api/batch/v1"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
 )
 
 type CronJob struct {
@@ -24,22 +24,17 @@ func (c CronJob) Name() string {
 func (c CronJob) Label() string {
 	return c.Delegate.Name
 }
+func (c CronJob) UID() k8sTypes.UID {
+	return c.Delegate.UID
+}
 
 func (c CronJob) OwnerReferences() []k8sMetaV1.OwnerReference {
 	return c.Delegate.OwnerReferences
 }
 func (c CronJob) IsOwnerOf(owner k8sMetaV1.OwnerReference) bool {
-	switch owner.Kind {
-	case "Job":
-		return strings.HasPrefix(owner.Name, c.Name())
-	}
-	return false
+	return owner.UID == c.UID()
 }
 
 func (c CronJob) ApplicationConfigs() []ApplicationConfig {
-	var apps []ApplicationConfig
-	for _, c := range c.Delegate.Spec.JobTemplate.Spec.Template.Spec.Containers {
-		apps = append(apps, ApplicationConfig{ContainerName: c.Name, ImageName: c.Image, Resources: c.Resources})
-	}
-	return apps
+	return withImageTriggers(applicationConfigsOf(c.Delegate.Spec.JobTemplate.Spec.Template), annotationImageTriggers(c.Delegate.ObjectMeta))
 }
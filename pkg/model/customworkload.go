@@ -0,0 +1,98 @@
+package model
+
+import (
+	"fmt"
+
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// CustomWorkloadKind locates the containers of a custom workload, either from its pod template or from its list of
+// containers
+type CustomWorkloadKind struct {
+	podTemplate *jsonpath.JSONPath
+	containers  *jsonpath.JSONPath
+}
+
+// NewCustomWorkloadKind parses the given JSONPath expressions, where only one of them is expected to be not empty
+func NewCustomWorkloadKind(podTemplatePath string, containersPath string) (*CustomWorkloadKind, error) {
+	kind := &CustomWorkloadKind{}
+	var err error
+	if podTemplatePath != "" {
+		kind.podTemplate, err = parseJSONPath(podTemplatePath)
+	} else {
+		kind.containers, err = parseJSONPath(containersPath)
+	}
+	return kind, err
+}
+
+func parseJSONPath(path string) (*jsonpath.JSONPath, error) {
+	parser := jsonpath.New(path).AllowMissingKeys(true)
+	if err := parser.Parse(path); err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %s: %w", path, err)
+	}
+	return parser, nil
+}
+
+// CustomWorkload is a workload of a custom kind, collected with the dynamic client
+type CustomWorkload struct {
+	UnstructuredResource
+	WorkloadKind *CustomWorkloadKind
+}
+
+func (w CustomWorkload) ApplicationConfigs() []ApplicationConfig {
+	var template k8sCoreV1.PodTemplateSpec
+	if w.WorkloadKind.podTemplate != nil {
+		values := w.find(w.WorkloadKind.podTemplate)
+		if len(values) == 0 || !w.convert(values[0], &template) {
+			return nil
+		}
+	} else {
+		for _, value := range w.find(w.WorkloadKind.containers) {
+			if containers, ok := value.([]interface{}); ok {
+				for _, item := range containers {
+					var container k8sCoreV1.Container
+					if w.convert(item, &container) {
+						template.Spec.Containers = append(template.Spec.Containers, container)
+					}
+				}
+			} else {
+				var container k8sCoreV1.Container
+				if w.convert(value, &container) {
+					template.Spec.Containers = append(template.Spec.Containers, container)
+				}
+			}
+		}
+	}
+	return applicationConfigsOf(template)
+}
+
+func (w CustomWorkload) find(path *jsonpath.JSONPath) []interface{} {
+	var values []interface{}
+	results, err := path.FindResults(w.Delegate.Object)
+	if err != nil {
+		logger.Warnf("Cannot evaluate JSONPath on %s %s: %s", w.Kind(), w.Name(), err)
+		return values
+	}
+	for _, result := range results {
+		for _, value := range result {
+			values = append(values, value.Interface())
+		}
+	}
+	return values
+}
+
+func (w CustomWorkload) convert(value interface{}, target interface{}) bool {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		logger.Warnf("Unexpected value of type %T in %s %s", value, w.Kind(), w.Name())
+		return false
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object, target); err != nil {
+		logger.Warnf("Cannot convert value in %s %s: %s", w.Kind(), w.Name(), err)
+		return false
+	}
+	return true
+}
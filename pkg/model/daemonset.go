@@ -2,10 +2,10 @@ package model
 
 import (
 	"fmt"
-	"strings"
 
 	k8sAppsV1 "k8s.io/api/apps/v1"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
 )
 
 type DaemonSet struct {
@@ -24,22 +24,17 @@ func (d DaemonSet) Name() string {
 func (d DaemonSet) Label() string {
 	return d.Delegate.Name
 }
+func (d DaemonSet) UID() k8sTypes.UID {
+	return d.Delegate.UID
+}
 
 func (d DaemonSet) OwnerReferences() []k8sMetaV1.OwnerReference {
 	return d.Delegate.OwnerReferences
 }
 func (d DaemonSet) IsOwnerOf(owner k8sMetaV1.OwnerReference) bool {
-	switch owner.Kind {
-	case "DaemonSet":
-		return strings.Compare(owner.Name, d.Name()) == 0
-	}
-	return false
+	return owner.UID == d.UID()
 }
 
 func (d DaemonSet) ApplicationConfigs() []ApplicationConfig {
-	var apps []ApplicationConfig
-	for _, c := range d.Delegate.Spec.Template.Spec.Containers {
-		apps = append(apps, ApplicationConfig{ContainerName: c.Name, ImageName: c.Image, Resources: c.Resources})
-	}
-	return apps
+	return withImageTriggers(applicationConfigsOf(d.Delegate.Spec.Template), annotationImageTriggers(d.Delegate.ObjectMeta))
 }
@@ -2,10 +2,10 @@ package model
 
 import (
 	"fmt"
-	"strings"
 
 	appsV1 "github.com/openshift/api/apps/v1"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
 )
 
 type DeploymentConfig struct {
@@ -24,24 +24,20 @@ func (d DeploymentConfig) Name() string {
 func (d DeploymentConfig) Label() string {
 	return d.Delegate.Name
 }
+func (d DeploymentConfig) UID() k8sTypes.UID {
+	return d.Delegate.UID
+}
 
 func (d DeploymentConfig) OwnerReferences() []k8sMetaV1.OwnerReference {
 	return d.Delegate.OwnerReferences
 }
 func (d DeploymentConfig) IsOwnerOf(owner k8sMetaV1.OwnerReference) bool {
-	switch owner.Kind {
-	case "DeploymentConfig":
-		return strings.Compare(owner.Name, d.Name()) == 0
-	case "ReplicationController":
-		return strings.HasPrefix(owner.Name, d.Name())
-	}
-	return false
+	return owner.UID == d.UID()
 }
 
 func (d DeploymentConfig) ApplicationConfigs() []ApplicationConfig {
-	var apps []ApplicationConfig
-	for _, c := range d.Delegate.Spec.Template.Spec.Containers {
-		apps = append(apps, ApplicationConfig{ContainerName: c.Name, ImageName: c.Image, Resources: c.Resources})
+	if d.Delegate.Spec.Template == nil {
+		return nil
 	}
-	return apps
+	return withImageTriggers(applicationConfigsOf(*d.Delegate.Spec.Template), deploymentConfigImageTriggers(d.Delegate))
 }
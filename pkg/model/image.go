@@ -2,7 +2,7 @@ package model
 
 import (
 	"encoding/json"
-	"strings"
+	"time"
 
 	logger "github.com/dmartinol/application-exporter/pkg/log"
 	"github.com/openshift/api/image/docker10"
@@ -13,10 +13,47 @@ type ApplicationImage interface {
 	ImageFullName() string
 	ImageName() string
 	ImageVersion() string
+	// ImageTag returns the tag of the image reference, or an empty string if not tagged
+	ImageTag() string
+	// ImageLabels returns the labels of the image configuration, if known
+	ImageLabels() map[string]string
+	// ImageEnv returns the environment variables of the image configuration, like NAME=VALUE, if known
+	ImageEnv() []string
+	// ImageCreated returns the creation time of the image, or the zero time if unknown
+	ImageCreated() time.Time
+	// ImageSize returns the compressed size of the image in bytes, or 0 if unknown
+	ImageSize() int64
+	// ImageLayers returns the compressed layers of the image, if known
+	ImageLayers() []ImageLayer
+}
+
+// ImageLayer is a compressed layer of an image, identified by its digest
+type ImageLayer struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// layersSize returns the total size of the given layers
+func layersSize(layers []ImageLayer) int64 {
+	var size int64
+	for _, layer := range layers {
+		size += layer.Size
+	}
+	return size
+}
+
+// ImageConfig is the configuration of an image, and its compressed layers, as fetched from its registry
+type ImageConfig struct {
+	Created time.Time         `json:"created"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Env     []string          `json:"env,omitempty"`
+	Layers  []ImageLayer      `json:"layers,omitempty"`
 }
 
 type Image struct {
 	FullName string
+	// Config is only known when fetched from the registry
+	Config *ImageConfig
 }
 
 func NewImageByRegistry(imageName string) *Image {
@@ -27,66 +64,118 @@ func (i *Image) ImageFullName() string {
 	return i.FullName
 }
 func (i *Image) ImageName() string {
-	imageName := i.FullName[strings.LastIndex(i.FullName, "/")+1:]
-	if strings.Contains(imageName, ":") {
-		imageName = imageName[0:strings.LastIndex(imageName, ":")]
+	ref, err := ParseImageReference(i.FullName)
+	if err != nil {
+		logger.Warnf("Cannot parse image %s: %s", i.FullName, err)
+		return i.FullName
 	}
-	return imageName
+	return ref.Name()
 }
 func (i *Image) ImageVersion() string {
-	imageName := i.FullName[strings.LastIndex(i.FullName, "/")+1:]
-	if strings.Contains(imageName, ":") {
-		return strings.Split(imageName, ":")[1]
+	version, _ := DefaultVersionExtractor.ImageVersion(i, ApplicationConfig{})
+	return version
+}
+func (i *Image) ImageTag() string {
+	ref, _ := ParseImageReference(i.FullName)
+	return ref.Tag
+}
+func (i *Image) ImageLabels() map[string]string {
+	if i.Config == nil {
+		return nil
+	}
+	return i.Config.Labels
+}
+func (i *Image) ImageEnv() []string {
+	if i.Config == nil {
+		return nil
+	}
+	return i.Config.Env
+}
+func (i *Image) ImageCreated() time.Time {
+	if i.Config == nil {
+		return time.Time{}
+	}
+	return i.Config.Created
+}
+func (i *Image) ImageSize() int64 {
+	return layersSize(i.ImageLayers())
+}
+func (i *Image) ImageLayers() []ImageLayer {
+	if i.Config == nil {
+		return nil
 	}
-	return "NA"
+	return i.Config.Layers
 }
 
 type ImageByStream struct {
 	FullName string
 	Delegate imageV1.Image
+	metadata docker10.DockerImage
 }
 
 func NewImageByStream(imageFullName string, delegate imageV1.Image) *ImageByStream {
 	imageByStream := &ImageByStream{Delegate: delegate}
 	imageByStream.FullName = imageFullName
+	if len(delegate.DockerImageMetadata.Raw) != 0 {
+		if err := json.Unmarshal(delegate.DockerImageMetadata.Raw, &imageByStream.metadata); err != nil {
+			logger.Warnf("Cannot unmarshal DockerImageMetadata of %s: %s", delegate.Name, err)
+		}
+	} else {
+		logger.Debugf("No DockerImageMetadata for %s", delegate.Name)
+	}
 	return imageByStream
 }
 func (i *ImageByStream) ImageFullName() string {
 	return i.FullName
 }
 func (i *ImageByStream) ImageName() string {
-	imagePath := i.onlyImagePath()
-	imageName := imagePath[strings.LastIndex(imagePath, "/")+1:]
-	if strings.Contains(imageName, ":") {
-		imageName = imageName[0:strings.LastIndex(imageName, ":")]
+	ref, err := ParseImageReference(i.imageReference())
+	if err != nil {
+		logger.Warnf("Cannot parse image %s: %s", i.imageReference(), err)
+		return i.imageReference()
 	}
-	logger.Debugf("Image name of %s is %s", i.imageReference(), imageName)
-	return imageName
+	logger.Debugf("Image name of %s is %s", i.imageReference(), ref.Name())
+	return ref.Name()
 }
 func (i *ImageByStream) ImageVersion() string {
-	imageName := i.onlyImagePath()
-	imageVersion := "NA"
-	if strings.LastIndex(imageName, ":") > strings.LastIndex(imageName, "/") {
-		imageVersion = imageName[strings.LastIndex(imageName, ":")+1:]
-	} else {
-		obj := &docker10.DockerImage{}
-		if len(i.Delegate.DockerImageMetadata.Raw) != 0 {
-			if err := json.Unmarshal(i.Delegate.DockerImageMetadata.Raw, obj); err != nil {
-				logger.Warnf("Cannot unmarshal DockerImageMetadata: %s", err)
-			} else {
-				logger.Debugf("Config.Labels for %s: %s", imageName, obj.Config.Labels)
-				imageVersion = obj.Config.Labels["version"]
-			}
-		} else {
-			logger.Warnf("No DockerImageMetadata for %s", i.Delegate.Name)
-		}
+	version, _ := DefaultVersionExtractor.ImageVersion(i, ApplicationConfig{})
+	logger.Debugf("Image version of %s is %s", i.imageReference(), version)
+	return version
+}
+func (i *ImageByStream) ImageTag() string {
+	ref, _ := ParseImageReference(i.imageReference())
+	return ref.Tag
+}
+func (i *ImageByStream) ImageLabels() map[string]string {
+	if i.metadata.Config == nil {
+		return nil
 	}
-	logger.Debugf("Image version of %s is %s", i.imageReference(), imageVersion)
-	return imageVersion
+	return i.metadata.Config.Labels
 }
-func (i *ImageByStream) onlyImagePath() string {
-	// Remove @sha
-	return strings.Split(i.imageReference(), "@")[0]
+func (i *ImageByStream) ImageEnv() []string {
+	if i.metadata.Config == nil {
+		return nil
+	}
+	return i.metadata.Config.Env
+}
+func (i *ImageByStream) ImageCreated() time.Time {
+	return i.metadata.Created.Time
+}
+
+// ImageSize returns the size of the DockerImageMetadata, which is the sum of the compressed layers, or else the sum of
+// the DockerImageLayers
+func (i *ImageByStream) ImageSize() int64 {
+	if i.metadata.Size > 0 {
+		return i.metadata.Size
+	}
+	return layersSize(i.ImageLayers())
+}
+func (i *ImageByStream) ImageLayers() []ImageLayer {
+	var layers []ImageLayer
+	for _, layer := range i.Delegate.DockerImageLayers {
+		layers = append(layers, ImageLayer{Digest: layer.Name, Size: layer.LayerSize})
+	}
+	return layers
 }
 func (i *ImageByStream) imageReference() string {
 	return i.Delegate.DockerImageReference
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultRegistry is the registry of the image references without any registry, like nginx:1.23
+	DefaultRegistry = "docker.io"
+	// DefaultRepositoryPrefix is the prefix of the single component repositories of the DefaultRegistry
+	DefaultRepositoryPrefix = "library/"
+)
+
+var (
+	repositoryComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*$`)
+	registryRegexp            = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*|\[[a-fA-F0-9:]+\])(?::[0-9]+)?$`)
+	tagRegexp                 = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp              = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+// ImageReference is a parsed container image reference, like registry:5000/team/app:1.0@sha256:...
+type ImageReference struct {
+	// Registry is the host of the registry, with the port if any, like quay.io or registry:5000
+	Registry string
+	// Repository is the path of the image in the registry, like team/app or library/nginx
+	Repository string
+	// Tag is empty when the reference has no tag
+	Tag string
+	// Digest is empty when the reference has no digest, like sha256:...
+	Digest string
+}
+
+// ParseImageReference parses the given reference, normalizing the references without registry to the
+// DefaultRegistry and the single component repositories of the DefaultRegistry to the DefaultRepositoryPrefix
+func ParseImageReference(reference string) (ImageReference, error) {
+	var ref ImageReference
+	name := reference
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+		if !digestRegexp.MatchString(ref.Digest) {
+			return ImageReference{}, fmt.Errorf("invalid digest in image reference %s", reference)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+		if !tagRegexp.MatchString(ref.Tag) {
+			return ImageReference{}, fmt.Errorf("invalid tag in image reference %s", reference)
+		}
+	}
+
+	// The first component is the registry only if it looks like a host, e.g. with a domain, a port or as localhost
+	ref.Registry, ref.Repository = DefaultRegistry, name
+	if i := strings.Index(name, "/"); i >= 0 {
+		if first := name[:i]; strings.ContainsAny(first, ".:[") || first == "localhost" || strings.ToLower(first) != first {
+			ref.Registry, ref.Repository = first, name[i+1:]
+		}
+	}
+	if !registryRegexp.MatchString(ref.Registry) {
+		return ImageReference{}, fmt.Errorf("invalid registry in image reference %s", reference)
+	}
+	if ref.Registry == DefaultRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = DefaultRepositoryPrefix + ref.Repository
+	}
+	for _, component := range strings.Split(ref.Repository, "/") {
+		if !repositoryComponentRegexp.MatchString(component) {
+			return ImageReference{}, fmt.Errorf("invalid repository in image reference %s", reference)
+		}
+	}
+	return ref, nil
+}
+
+// Host returns the host of the registry, without the port
+func (r ImageReference) Host() string {
+	if i := strings.LastIndex(r.Registry, ":"); i > strings.LastIndex(r.Registry, "]") {
+		return r.Registry[:i]
+	}
+	return r.Registry
+}
+
+// Port returns the port of the registry, or an empty string if not given
+func (r ImageReference) Port() string {
+	if i := strings.LastIndex(r.Registry, ":"); i > strings.LastIndex(r.Registry, "]") {
+		return r.Registry[i+1:]
+	}
+	return ""
+}
+
+// Name returns the last component of the repository, like app for team/app
+func (r ImageReference) Name() string {
+	return r.Repository[strings.LastIndex(r.Repository, "/")+1:]
+}
+
+// String returns the normalized reference
+func (r ImageReference) String() string {
+	reference := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		reference += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		reference += "@" + r.Digest
+	}
+	return reference
+}
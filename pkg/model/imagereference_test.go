@@ -0,0 +1,60 @@
+package model
+
+import "testing"
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		reference string
+		expected  ImageReference
+		port      string
+	}{
+		{"nginx", ImageReference{Registry: "docker.io", Repository: "library/nginx"}, ""},
+		{"nginx:1.23", ImageReference{Registry: "docker.io", Repository: "library/nginx", Tag: "1.23"}, ""},
+		{"bitnami/redis:7.0", ImageReference{Registry: "docker.io", Repository: "bitnami/redis", Tag: "7.0"}, ""},
+		{"registry:5000/team/app", ImageReference{Registry: "registry:5000", Repository: "team/app"}, "5000"},
+		{"localhost/app:dev", ImageReference{Registry: "localhost", Repository: "app", Tag: "dev"}, ""},
+		{"quay.io/x/app@" + testDigest, ImageReference{Registry: "quay.io", Repository: "x/app", Digest: testDigest}, ""},
+		{"quay.io/x/app:1.0@" + testDigest, ImageReference{Registry: "quay.io", Repository: "x/app", Tag: "1.0", Digest: testDigest}, ""},
+		{"image-registry.openshift-image-registry.svc:5000/ns/app@" + testDigest,
+			ImageReference{Registry: "image-registry.openshift-image-registry.svc:5000", Repository: "ns/app", Digest: testDigest}, "5000"},
+		{"[::1]:5000/app:1", ImageReference{Registry: "[::1]:5000", Repository: "app", Tag: "1"}, "5000"},
+	}
+	for _, test := range tests {
+		ref, err := ParseImageReference(test.reference)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %s: %s", test.reference, err)
+			continue
+		}
+		if ref != test.expected {
+			t.Errorf("Expected %+v for %s, got %+v", test.expected, test.reference, ref)
+		}
+		if ref.Port() != test.port {
+			t.Errorf("Expected port %q for %s, got %q", test.port, test.reference, ref.Port())
+		}
+	}
+}
+
+func TestParseInvalidImageReference(t *testing.T) {
+	for _, reference := range []string{"", "quay.io/x/App:1.0", "quay.io/x/app:", "quay.io/x/app@sha256:short", "quay.io//app", "app:1.0:2.0"} {
+		if ref, err := ParseImageReference(reference); err == nil {
+			t.Errorf("Expected error parsing %q, got %+v", reference, ref)
+		}
+	}
+}
+
+func TestImageVersion(t *testing.T) {
+	if version := NewImageByRegistry("registry:5000/team/app").ImageVersion(); version != "NA" {
+		t.Errorf("Expected no version, got %s", version)
+	}
+	if version := NewImageByRegistry("quay.io/x/app@" + testDigest).ImageVersion(); version != "NA" {
+		t.Errorf("Expected no version, got %s", version)
+	}
+	if name := NewImageByRegistry("quay.io/x/app@" + testDigest).ImageName(); name != "app" {
+		t.Errorf("Expected name app, got %s", name)
+	}
+	if version := NewImageByRegistry("registry:5000/team/app:2.1").ImageVersion(); version != "2.1" {
+		t.Errorf("Expected version 2.1, got %s", version)
+	}
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	appsV1 "github.com/openshift/api/apps/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ImageTriggersAnnotation declares the containers of a Kubernetes workload updated by OpenShift when an ImageStreamTag
+// changes, like [{"from":{"kind":"ImageStreamTag","name":"app:latest"},"fieldPath":"spec.template.spec.containers[?(@.name==\"app\")].image"}]
+const ImageTriggersAnnotation = "image.openshift.io/triggers"
+
+var triggerFieldPathRegexp = regexp.MustCompile(`(?:initContainers|containers)\[\?\(@\.name=="([^"]+)"\)\]\.image$`)
+
+// ImageTrigger is the ImageStreamTag whose latest image is deployed in a container
+type ImageTrigger struct {
+	Namespace string
+	// Name of the ImageStreamTag, like app:latest
+	Name string
+}
+
+// Stream returns the name of the ImageStream, like app for app:latest
+func (t ImageTrigger) Stream() string {
+	stream, _, _ := strings.Cut(t.Name, ":")
+	return stream
+}
+
+// Tag returns the tag of the ImageStream, like latest for app:latest
+func (t ImageTrigger) Tag() string {
+	_, tag, _ := strings.Cut(t.Name, ":")
+	return tag
+}
+
+// annotationImageTriggers returns the ImageTriggers by container name declared in the ImageTriggersAnnotation of the
+// given workload
+func annotationImageTriggers(meta k8sMetaV1.ObjectMeta) map[string]ImageTrigger {
+	value, ok := meta.Annotations[ImageTriggersAnnotation]
+	if !ok {
+		return nil
+	}
+	var annotationTriggers []struct {
+		From struct {
+			Kind      string `json:"kind"`
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"from"`
+		FieldPath string `json:"fieldPath"`
+	}
+	if err := json.Unmarshal([]byte(value), &annotationTriggers); err != nil {
+		logger.Warnf("Cannot parse the %s annotation of %s: %s", ImageTriggersAnnotation, meta.Name, err)
+		return nil
+	}
+	triggers := make(map[string]ImageTrigger)
+	for _, trigger := range annotationTriggers {
+		match := triggerFieldPathRegexp.FindStringSubmatch(trigger.FieldPath)
+		if trigger.From.Kind != "ImageStreamTag" || match == nil {
+			continue
+		}
+		triggers[match[1]] = newImageTrigger(meta.Namespace, trigger.From.Namespace, trigger.From.Name)
+	}
+	return triggers
+}
+
+// deploymentConfigImageTriggers returns the ImageTriggers by container name of the ImageChange triggers of the given
+// DeploymentConfig
+func deploymentConfigImageTriggers(deploymentConfig appsV1.DeploymentConfig) map[string]ImageTrigger {
+	triggers := make(map[string]ImageTrigger)
+	for _, trigger := range deploymentConfig.Spec.Triggers {
+		params := trigger.ImageChangeParams
+		if trigger.Type != appsV1.DeploymentTriggerOnImageChange || params == nil || params.From.Kind != "ImageStreamTag" {
+			continue
+		}
+		for _, containerName := range params.ContainerNames {
+			triggers[containerName] = newImageTrigger(deploymentConfig.Namespace, params.From.Namespace, params.From.Name)
+		}
+	}
+	return triggers
+}
+
+func newImageTrigger(workloadNamespace string, namespace string, name string) ImageTrigger {
+	if namespace == "" {
+		namespace = workloadNamespace
+	}
+	return ImageTrigger{Namespace: namespace, Name: name}
+}
+
+// withImageTriggers sets the ImageTrigger of the given containers, by container name
+func withImageTriggers(apps []ApplicationConfig, triggers map[string]ImageTrigger) []ApplicationConfig {
+	for i := range apps {
+		if trigger, ok := triggers[apps[i].ContainerName]; ok {
+			apps[i].ImageTrigger = &trigger
+		}
+	}
+	return apps
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"fmt"
+
+	k8sBatchV1 "k8s.io/api/batch/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+)
+
+type Job struct {
+	Delegate k8sBatchV1.Job
+}
+
+func (j Job) Kind() string {
+	return "Job"
+}
+func (j Job) Id() string {
+	return fmt.Sprintf("job %s", j.Delegate.Name)
+}
+func (j Job) Name() string {
+	return j.Delegate.Name
+}
+func (j Job) Label() string {
+	return j.Delegate.Name
+}
+func (j Job) UID() k8sTypes.UID {
+	return j.Delegate.UID
+}
+
+func (j Job) OwnerReferences() []k8sMetaV1.OwnerReference {
+	return j.Delegate.OwnerReferences
+}
+func (j Job) IsOwnerOf(owner k8sMetaV1.OwnerReference) bool {
+	return owner.UID == j.UID()
+}
+
+func (j Job) ApplicationConfigs() []ApplicationConfig {
+	return withImageTriggers(applicationConfigsOf(j.Delegate.Spec.Template), annotationImageTriggers(j.Delegate.ObjectMeta))
+}
+func (j Job) IsOrphanProvider() bool {
+	return len(j.OwnerReferences()) == 0
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	k8sCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// KnativeService is a serving.knative.dev Service, reporting the containers of its latest ready Revision
+type KnativeService struct {
+	UnstructuredResource
+	LatestReadyRevision *KnativeRevision
+}
+
+func (s KnativeService) Kind() string {
+	return "KnativeService"
+}
+func (s KnativeService) LatestReadyRevisionName() string {
+	name, _, _ := unstructured.NestedString(s.Delegate.Object, "status", "latestReadyRevisionName")
+	return name
+}
+
+func (s KnativeService) ApplicationConfigs() []ApplicationConfig {
+	if s.LatestReadyRevision != nil {
+		return s.LatestReadyRevision.applicationConfigs()
+	}
+	podSpec, ok := s.nestedPodSpec("spec", "template", "spec")
+	if !ok {
+		return nil
+	}
+	return applicationConfigsOf(k8sCoreV1.PodTemplateSpec{Spec: podSpec})
+}
+
+// PodsOwner returns the latest ready Revision, which owns the pods of the Service
+func (s KnativeService) PodsOwner() Resource {
+	if s.LatestReadyRevision != nil {
+		return *s.LatestReadyRevision
+	}
+	return s
+}
+
+// KnativeRevision is a serving.knative.dev Revision, with the image digests resolved by Knative. It's not an
+// ApplicationProvider, its containers are reported by the owning KnativeService
+type KnativeRevision struct {
+	UnstructuredResource
+}
+
+func (r KnativeRevision) applicationConfigs() []ApplicationConfig {
+	podSpec, ok := r.nestedPodSpec("spec")
+	if !ok {
+		return nil
+	}
+	imageDigests := make(map[string]string)
+	containerStatuses, _, _ := unstructured.NestedSlice(r.Delegate.Object, "status", "containerStatuses")
+	for _, containerStatus := range containerStatuses {
+		if status, ok := containerStatus.(map[string]interface{}); ok {
+			name, _, _ := unstructured.NestedString(status, "name")
+			imageDigest, _, _ := unstructured.NestedString(status, "imageDigest")
+			imageDigests[name] = imageDigest
+		}
+	}
+
+	apps := applicationConfigsOf(k8sCoreV1.PodTemplateSpec{Spec: podSpec})
+	for i := range apps {
+		apps[i].ImageDigest = imageDigests[apps[i].ContainerName]
+	}
+	return apps
+}
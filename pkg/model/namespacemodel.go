@@ -1,63 +1,199 @@
 package model
 
 import (
-	"strings"
+	"sort"
 
 	logger "github.com/dmartinol/application-exporter/pkg/log"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
 )
 
+// NamespaceModel indexes the resources of a namespace by kind, Id, name and UID, and the pods by any of their owners,
+// so that lookups don't need to scan the whole namespace
 type NamespaceModel struct {
+	cluster         string
 	name            string
 	resourcesByKind map[string][]Resource
+	resourcesById   map[string]map[string]Resource
+	resourcesByName map[string]map[string]Resource
+	resourcesByUID  map[k8sTypes.UID]Resource
+	podsByOwner     map[k8sTypes.UID][]Pod
+	latestImages    map[ImageTrigger]string
+	builds          map[BuildReference]*Build
 }
 
+// NewNamespaceModel returns an empty namespace of the given cluster, to be populated before adding it to a TopologyModel
+func NewNamespaceModel(cluster string, name string) *NamespaceModel {
+	return &NamespaceModel{
+		cluster:         cluster,
+		name:            name,
+		resourcesByKind: make(map[string][]Resource),
+		resourcesById:   make(map[string]map[string]Resource),
+		resourcesByName: make(map[string]map[string]Resource),
+		resourcesByUID:  make(map[k8sTypes.UID]Resource),
+		podsByOwner:     make(map[k8sTypes.UID][]Pod),
+		latestImages:    make(map[ImageTrigger]string),
+		builds:          make(map[BuildReference]*Build),
+	}
+}
+
+// Cluster returns the name of the cluster of the namespace, like the name of its kubeconfig context
+func (namespace NamespaceModel) Cluster() string {
+	return namespace.cluster
+}
 func (namespace NamespaceModel) Name() string {
 	return namespace.name
 }
 
-func (namespace NamespaceModel) LookupByKindAndId(kind string, id string) Resource {
-	for _, resource := range namespace.resourcesByKind[kind] {
-		if strings.Compare(id, resource.Id()) == 0 {
-			return resource
-		}
-	}
+// AddLatestImage sets the digest of the latest image of the given ImageStreamTag, as resolved for the workloads of the
+// namespace
+func (namespace NamespaceModel) AddLatestImage(trigger ImageTrigger, digest string) {
+	namespace.latestImages[trigger] = digest
+}
 
-	return nil
+// LatestImageOf returns the digest of the latest image of the given ImageStreamTag, if resolved
+func (namespace NamespaceModel) LatestImageOf(trigger ImageTrigger) (string, bool) {
+	digest, ok := namespace.latestImages[trigger]
+	return digest, ok
+}
+
+// AddBuild sets the Build of the given reference, as loaded for the images of the namespace, or nil if not found
+func (namespace NamespaceModel) AddBuild(ref BuildReference, build *Build) {
+	namespace.builds[ref] = build
 }
 
+// BuildOf returns the Build of the given reference, which is nil if not found, and false if not loaded
+func (namespace NamespaceModel) BuildOf(ref BuildReference) (*Build, bool) {
+	build, ok := namespace.builds[ref]
+	return build, ok
+}
+
+func (namespace NamespaceModel) LookupByKindAndId(kind string, id string) Resource {
+	return namespace.resourcesById[kind][id]
+}
+func (namespace NamespaceModel) LookupByKindAndName(kind string, name string) Resource {
+	return namespace.resourcesByName[kind][name]
+}
+func (namespace NamespaceModel) LookupByUID(uid k8sTypes.UID) Resource {
+	return namespace.resourcesByUID[uid]
+}
+
+// AddResource adds the given resource, if not already there. Pods are indexed by all their owners, so they must be added
+// after all the other resources
 func (namespace NamespaceModel) AddResource(resource Resource) bool {
 	if namespace.LookupByKindAndId(resource.Kind(), resource.Id()) == nil {
 		logger.Debugf("Adding resource %s of kind %s", resource.Name(), resource.Kind())
-		namespace.resourcesByKind[resource.Kind()] = append(namespace.resourcesByKind[resource.Kind()], resource)
+		namespace.index(resource)
+		if pod, ok := resource.(Pod); ok {
+			namespace.indexPod(pod)
+		}
 		return true
 	}
 	logger.Debugf("Skipped existing resource %s of kind %s", resource.Name(), resource.Kind())
 	return false
 }
+func (namespace NamespaceModel) index(resource Resource) {
+	kind := resource.Kind()
+	namespace.resourcesByKind[kind] = append(namespace.resourcesByKind[kind], resource)
+	if _, ok := namespace.resourcesById[kind]; !ok {
+		namespace.resourcesById[kind] = make(map[string]Resource)
+		namespace.resourcesByName[kind] = make(map[string]Resource)
+	}
+	namespace.resourcesById[kind][resource.Id()] = resource
+	namespace.resourcesByName[kind][resource.Name()] = resource
+	if resource.UID() != "" {
+		namespace.resourcesByUID[resource.UID()] = resource
+	}
+}
 func (namespace NamespaceModel) LookupOwner(owner k8sMetaV1.OwnerReference) Resource {
-	for _, resources := range namespace.resourcesByKind {
-		for _, resource := range resources {
-			if resource.IsOwnerOf(owner) {
-				return resource
-			}
+	if resource, ok := namespace.resourcesByUID[owner.UID]; ok && resource.IsOwnerOf(owner) {
+		return resource
+	}
+	return nil
+}
+
+// OwnersOf returns the full chain of collected resources owning the given one, following the ownerReferences by UID
+// (e.g. the ReplicaSet and then the Deployment of a Pod)
+func (namespace NamespaceModel) OwnersOf(resource Resource) []Resource {
+	var owners []Resource
+	visited := map[k8sTypes.UID]bool{resource.UID(): true}
+	pending := append([]k8sMetaV1.OwnerReference{}, resource.OwnerReferences()...)
+	for len(pending) > 0 {
+		ref := pending[0]
+		pending = pending[1:]
+		if visited[ref.UID] {
+			continue
+		}
+		visited[ref.UID] = true
+		if owner := namespace.LookupOwner(ref); owner != nil {
+			owners = append(owners, owner)
+			pending = append(pending, owner.OwnerReferences()...)
+		} else {
+			logger.Debugf("Owner %s %s of %s %s was not collected", ref.Kind, ref.Name, resource.Kind(), resource.Name())
 		}
 	}
+	return owners
+}
+
+// TopOwnerOf returns the top-most collected owner of the given resource following the controller references, or nil if
+// the resource has no collected owners
+func (namespace NamespaceModel) TopOwnerOf(resource Resource) Resource {
+	var topOwner Resource
+	visited := map[k8sTypes.UID]bool{resource.UID(): true}
+	for ref := controllerOf(resource.OwnerReferences()); ref != nil && !visited[ref.UID]; {
+		visited[ref.UID] = true
+		owner := namespace.LookupOwner(*ref)
+		if owner == nil {
+			break
+		}
+		topOwner = owner
+		ref = controllerOf(owner.OwnerReferences())
+	}
+	return topOwner
+}
+
+// controllerOf returns the reference to the managing controller, if any, or the first reference
+func controllerOf(ownerReferences []k8sMetaV1.OwnerReference) *k8sMetaV1.OwnerReference {
+	for i := range ownerReferences {
+		if ownerReferences[i].Controller != nil && *ownerReferences[i].Controller {
+			return &ownerReferences[i]
+		}
+	}
+	if len(ownerReferences) > 0 {
+		return &ownerReferences[0]
+	}
 	return nil
 }
 
+func (namespace NamespaceModel) indexPod(pod Pod) {
+	for _, owner := range namespace.OwnersOf(pod) {
+		namespace.podsByOwner[owner.UID()] = append(namespace.podsByOwner[owner.UID()], pod)
+	}
+}
+
 func (namespace NamespaceModel) ResourcesByKind(kind string) []Resource {
 	return namespace.resourcesByKind[kind]
 }
+
+// AllApplicationProviders returns the resources providing applications, excluding those owned by other application
+// providers (e.g. the ReplicaSets of a Deployment or the Jobs of a CronJob)
 func (namespace NamespaceModel) AllApplicationProviders() []ApplicationProvider {
 	applicationProviders := make([]ApplicationProvider, 0)
 	for _, resource := range namespace.AllResources() {
-		if applicationProvider, ok := resource.(ApplicationProvider); ok {
+		if applicationProvider, ok := resource.(ApplicationProvider); ok && !namespace.isOwnedByApplicationProvider(resource) {
 			applicationProviders = append(applicationProviders, applicationProvider)
 		}
 	}
 	return applicationProviders
 }
+func (namespace NamespaceModel) isOwnedByApplicationProvider(resource Resource) bool {
+	for _, owner := range namespace.OwnersOf(resource) {
+		if _, ok := owner.(ApplicationProvider); ok {
+			return true
+		}
+	}
+	return false
+}
 func (namespace NamespaceModel) AllResources() []Resource {
 	resources := make([]Resource, 0)
 	for kind := range namespace.resourcesByKind {
@@ -65,14 +201,56 @@ func (namespace NamespaceModel) AllResources() []Resource {
 	}
 	return resources
 }
+
+// AllPodsOf returns the pods owned by the given parent, either directly or through intermediate resources, or the parent
+// itself if it's a Pod
 func (namespace NamespaceModel) AllPodsOf(parent Resource) []Pod {
-	var children []Pod
-	for _, pod := range namespace.ResourcesByKind("Pod") {
-		for _, ref := range pod.OwnerReferences() {
-			if parent.IsOwnerOf(ref) {
-				children = append(children, pod.(Pod))
+	if pod, ok := parent.(Pod); ok {
+		return []Pod{pod}
+	}
+	if podsOwnerProvider, ok := parent.(PodsOwnerProvider); ok {
+		parent = podsOwnerProvider.PodsOwner()
+	}
+	return namespace.podsByOwner[parent.UID()]
+}
+
+// ApplicationConfigsOf returns the configuration of the containers of the given provider, including the ephemeral
+// containers added to its pods, which are not part of the pod templates
+func (namespace NamespaceModel) ApplicationConfigsOf(applicationProvider ApplicationProvider) []ApplicationConfig {
+	return append(applicationProvider.ApplicationConfigs(), namespace.EphemeralConfigsOf(applicationProvider)...)
+}
+
+// EphemeralConfigsOf returns the configuration of the distinct ephemeral containers of all the pods of the given
+// provider, unless the provider is a Pod, which already includes them in its ApplicationConfigs
+func (namespace NamespaceModel) EphemeralConfigsOf(applicationProvider ApplicationProvider) []ApplicationConfig {
+	resource, ok := applicationProvider.(Resource)
+	if _, isPod := applicationProvider.(Pod); !ok || isPod {
+		return nil
+	}
+	var apps []ApplicationConfig
+	found := make(map[string]bool)
+	for _, pod := range namespace.AllPodsOf(resource) {
+		for _, app := range ephemeralConfigsOf(pod.Delegate) {
+			if key := app.ContainerName + " " + app.ImageName; !found[key] {
+				found[key] = true
+				apps = append(apps, app)
 			}
 		}
 	}
-	return children
+	return apps
+}
+
+// RunningImageDigests returns the sorted distinct digests of the images running in the given container of all the pods
+// of the given parent
+func (namespace NamespaceModel) RunningImageDigests(parent Resource, containerName string) []string {
+	var digests []string
+	found := make(map[string]bool)
+	for _, pod := range namespace.AllPodsOf(parent) {
+		if digest := pod.RunningImageDigest(containerName); digest != "" && !found[digest] {
+			found[digest] = true
+			digests = append(digests, digest)
+		}
+	}
+	sort.Strings(digests)
+	return digests
 }
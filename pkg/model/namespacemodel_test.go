@@ -0,0 +1,217 @@
+package model
+
+import (
+	"testing"
+
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+)
+
+// testPod returns a Pod named after its UID, owned by the given owners
+func testPod(name string, owners ...Resource) Pod {
+	pod := k8sCoreV1.Pod{ObjectMeta: k8sMetaV1.ObjectMeta{Name: name, UID: k8sTypes.UID(name)}}
+	for _, owner := range owners {
+		pod.OwnerReferences = append(pod.OwnerReferences, ControllerReference(owner.Kind(), owner.Name(), owner.UID()))
+	}
+	return Pod{Delegate: pod}
+}
+
+// testCustomResource returns a custom resource of the given kind, named after its UID
+func testCustomResource(kind string, name string) UnstructuredResource {
+	resource := UnstructuredResource{}
+	resource.Delegate.SetAPIVersion("example.com/v1")
+	resource.Delegate.SetKind(kind)
+	resource.Delegate.SetName(name)
+	resource.Delegate.SetUID(k8sTypes.UID(kind + "/" + name))
+	return resource
+}
+
+func TestOrphanProviders(t *testing.T) {
+	namespace := NewNamespaceModel("", "app")
+	database := testCustomResource("PostgresCluster", "db")
+	namespace.AddResource(database)
+	namespace.AddResource(testPod("db-0", database))
+	namespace.AddResource(testPod("debug"))
+	// The owner of the Pod was not collected, like an operator CR not readable by the exporter
+	namespace.AddResource(testPod("cache-0", testCustomResource("RedisCluster", "cache")))
+
+	orphans := map[string]bool{"db-0": false, "debug": true, "cache-0": false}
+	applicationProviders := namespace.AllApplicationProviders()
+	if len(applicationProviders) != len(orphans) {
+		t.Fatalf("Expected %d applications, got %d", len(orphans), len(applicationProviders))
+	}
+	for _, applicationProvider := range applicationProviders {
+		name := applicationProvider.(Resource).Name()
+		if orphan := IsOrphanProvider(applicationProvider); orphan != orphans[name] {
+			t.Errorf("Expected orphan %v for %s, got %v", orphans[name], name, orphan)
+		}
+	}
+	if owner := namespace.TopOwnerOf(namespace.LookupByKindAndName("Pod", "db-0")); owner == nil || owner.Name() != "db" {
+		t.Errorf("Expected owner db of db-0, got %v", owner)
+	}
+}
+
+// testDeployment returns a Deployment whose UID is made of its kind and name, unless a UID is given
+func testDeployment(name string, uid ...k8sTypes.UID) Deployment {
+	deployment := Deployment{}
+	deployment.Delegate.Name = name
+	deployment.Delegate.UID = k8sTypes.UID("Deployment/" + name)
+	if len(uid) > 0 {
+		deployment.Delegate.UID = uid[0]
+	}
+	return deployment
+}
+
+// testReplicaSet returns a ReplicaSet whose UID is made of its kind and name, owned by the given owner
+func testReplicaSet(name string, owner Resource) ReplicaSet {
+	replicaSet := ReplicaSet{}
+	replicaSet.Delegate.Name = name
+	replicaSet.Delegate.UID = k8sTypes.UID("ReplicaSet/" + name)
+	replicaSet.Delegate.OwnerReferences = []k8sMetaV1.OwnerReference{ControllerReference(owner.Kind(), owner.Name(), owner.UID())}
+	return replicaSet
+}
+
+// sameResource returns true if both resources are nil, or have the same kind and UID
+func sameResource(resource Resource, other Resource) bool {
+	if resource == nil || other == nil {
+		return resource == nil && other == nil
+	}
+	return resource.Kind() == other.Kind() && resource.UID() == other.UID()
+}
+
+func TestNamespaceModelLookups(t *testing.T) {
+	namespace := NewNamespaceModel("", "app")
+	web := testDeployment("web")
+	replicaSet := testReplicaSet("web-5d9f8c7b6", web)
+	pod := testPod("web-5d9f8c7b6-x2x4q", replicaSet)
+	for _, resource := range []Resource{web, replicaSet, pod} {
+		if !namespace.AddResource(resource) {
+			t.Errorf("Expected %s %s to be added", resource.Kind(), resource.Name())
+		}
+	}
+
+	lookups := []struct {
+		lookup   string
+		resource Resource
+		expected Resource
+	}{
+		{"kind and name", namespace.LookupByKindAndName("Deployment", "web"), web},
+		{"kind and name", namespace.LookupByKindAndName("Pod", "web-5d9f8c7b6-x2x4q"), pod},
+		{"kind and name", namespace.LookupByKindAndName("ReplicaSet", "web"), nil},
+		{"kind and name", namespace.LookupByKindAndName("StatefulSet", "web"), nil},
+		{"kind and Id", namespace.LookupByKindAndId("ReplicaSet", replicaSet.Id()), replicaSet},
+		{"UID", namespace.LookupByUID("ReplicaSet/web-5d9f8c7b6"), replicaSet},
+		{"UID", namespace.LookupByUID("missing"), nil},
+	}
+	for i, test := range lookups {
+		if !sameResource(test.resource, test.expected) {
+			t.Errorf("Test %d: expected %v by %s, got %v", i, test.expected, test.lookup, test.resource)
+		}
+	}
+
+	duplicates := []struct {
+		resource Resource
+		added    bool
+	}{
+		{web, false},
+		{testDeployment("web", "other-uid"), false},
+		{testReplicaSet("web", web), true},
+	}
+	for i, test := range duplicates {
+		if added := namespace.AddResource(test.resource); added != test.added {
+			t.Errorf("Test %d: expected added %v for %s %s, got %v", i, test.added, test.resource.Kind(), test.resource.Name(), added)
+		}
+	}
+	if deployments := namespace.ResourcesByKind("Deployment"); len(deployments) != 1 || namespace.LookupByUID("other-uid") != nil {
+		t.Errorf("Expected the duplicate Deployment to be skipped, got %d Deployments", len(deployments))
+	}
+
+	owners := []struct {
+		resource Resource
+		owners   []Resource
+	}{
+		{pod, []Resource{replicaSet, web}},
+		{replicaSet, []Resource{web}},
+		{web, nil},
+	}
+	for _, test := range owners {
+		resourceOwners := namespace.OwnersOf(test.resource)
+		if len(resourceOwners) != len(test.owners) {
+			t.Errorf("Expected %d owners of %s, got %d", len(test.owners), test.resource.Name(), len(resourceOwners))
+			continue
+		}
+		for i := range resourceOwners {
+			if !sameResource(resourceOwners[i], test.owners[i]) {
+				t.Errorf("Expected owner %s of %s, got %s", test.owners[i].Name(), test.resource.Name(), resourceOwners[i].Name())
+			}
+		}
+	}
+}
+
+func TestOwnersByUID(t *testing.T) {
+	namespace := NewNamespaceModel("", "app")
+	// A ReplicaSet named like its Deployment, and one left by a deleted Deployment with the same name
+	web := testDeployment("web")
+	replicaSet := testReplicaSet("web", web)
+	staleReplicaSet := testReplicaSet("web-7c9d", testDeployment("web", "deleted-uid"))
+	// A chain from an operator CR down to the pods
+	kieApp := testCustomResource("KieApp", "rhpam")
+	kieServer := testDeployment("rhpam-kieserver")
+	kieServer.Delegate.OwnerReferences = []k8sMetaV1.OwnerReference{ControllerReference(kieApp.Kind(), kieApp.Name(), kieApp.UID())}
+	kieServerReplicaSet := testReplicaSet("rhpam-kieserver-5d9f", kieServer)
+	for _, resource := range []Resource{web, replicaSet, staleReplicaSet, kieApp, kieServer, kieServerReplicaSet,
+		testPod("web-x2x4q", replicaSet), testPod("web-7c9d-q9w8e", staleReplicaSet),
+		testPod("rhpam-kieserver-5d9f-a", kieServerReplicaSet), testPod("rhpam-kieserver-5d9f-b", kieServerReplicaSet)} {
+		namespace.AddResource(resource)
+	}
+
+	tests := []struct {
+		resource Resource
+		owners   []Resource
+		pods     []string
+	}{
+		{namespace.LookupByKindAndName("Pod", "web-x2x4q"), []Resource{replicaSet, web}, nil},
+		{replicaSet, []Resource{web}, []string{"web-x2x4q"}},
+		{web, nil, []string{"web-x2x4q"}},
+		{staleReplicaSet, nil, []string{"web-7c9d-q9w8e"}},
+		{namespace.LookupByKindAndName("Pod", "rhpam-kieserver-5d9f-a"), []Resource{kieServerReplicaSet, kieServer, kieApp}, nil},
+		{kieServer, []Resource{kieApp}, []string{"rhpam-kieserver-5d9f-a", "rhpam-kieserver-5d9f-b"}},
+		{kieApp, nil, []string{"rhpam-kieserver-5d9f-a", "rhpam-kieserver-5d9f-b"}},
+	}
+	for _, test := range tests {
+		owners := namespace.OwnersOf(test.resource)
+		if len(owners) != len(test.owners) {
+			t.Errorf("Expected %d owners of %s %s, got %d", len(test.owners), test.resource.Kind(), test.resource.Name(), len(owners))
+		} else {
+			for i := range owners {
+				if !sameResource(owners[i], test.owners[i]) {
+					t.Errorf("Expected owner %s %s of %s, got %s %s", test.owners[i].Kind(), test.owners[i].Name(), test.resource.Name(), owners[i].Kind(), owners[i].Name())
+				}
+			}
+		}
+		if _, ok := test.resource.(Pod); ok {
+			continue
+		}
+		pods := namespace.AllPodsOf(test.resource)
+		if len(pods) != len(test.pods) {
+			t.Errorf("Expected pods %v of %s %s, got %d pods", test.pods, test.resource.Kind(), test.resource.Name(), len(pods))
+			continue
+		}
+		for i := range pods {
+			if pods[i].Name() != test.pods[i] {
+				t.Errorf("Expected pod %s of %s %s, got %s", test.pods[i], test.resource.Kind(), test.resource.Name(), pods[i].Name())
+			}
+		}
+	}
+
+	// The ReplicaSet of the deleted Deployment is not owned by the current one, so it's reported on its own
+	applicationProviders := namespace.AllApplicationProviders()
+	names := make(map[string]bool)
+	for _, applicationProvider := range applicationProviders {
+		names[applicationProvider.(Resource).Kind()+" "+applicationProvider.(Resource).Name()] = true
+	}
+	if len(applicationProviders) != 3 || !names["Deployment web"] || !names["ReplicaSet web-7c9d"] || !names["Deployment rhpam-kieserver"] {
+		t.Errorf("Expected the applications web, web-7c9d and rhpam-kieserver, got %v", names)
+	}
+}
@@ -2,10 +2,12 @@ package model
 
 import (
 	"fmt"
+	"strings"
 
 	logger "github.com/dmartinol/application-exporter/pkg/log"
 	k8sCoreV1 "k8s.io/api/core/v1"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
 	k8sMetricsV1Beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 )
 
@@ -32,6 +34,9 @@ func (p Pod) Name() string {
 func (p Pod) Label() string {
 	return p.Delegate.Name
 }
+func (p Pod) UID() k8sTypes.UID {
+	return p.Delegate.UID
+}
 
 func (p Pod) OwnerReferences() []k8sMetaV1.OwnerReference {
 	return p.Delegate.OwnerReferences
@@ -40,10 +45,23 @@ func (p Pod) IsOwnerOf(owner k8sMetaV1.OwnerReference) bool {
 	return false
 }
 
+func (p Pod) ApplicationConfigs() []ApplicationConfig {
+	apps := applicationConfigsOf(k8sCoreV1.PodTemplateSpec{ObjectMeta: p.Delegate.ObjectMeta, Spec: p.Delegate.Spec})
+	return append(apps, ephemeralConfigsOf(p.Delegate)...)
+}
+func (p Pod) IsOrphanProvider() bool {
+	return len(p.OwnerReferences()) == 0
+}
+
 func (p Pod) IsRunning() bool {
 	return p.Delegate.Status.Phase == k8sCoreV1.PodRunning
 }
 
+// NodeName returns the name of the node where the pod is scheduled, or an empty string if not scheduled
+func (p Pod) NodeName() string {
+	return p.Delegate.Spec.NodeName
+}
+
 func (p *Pod) SetMetrics(podMetrics *k8sMetricsV1Beta1.PodMetrics) {
 	p.PodMetrics = podMetrics
 }
@@ -63,3 +81,20 @@ func (p Pod) UsageForContainer(containerName string) k8sCoreV1.ResourceList {
 	}
 	return nil
 }
+
+// RunningImageDigest returns the digest of the image running in the given container, as resolved by the container
+// runtime in the imageID of its status (like docker-pullable://quay.io/team/app@sha256:...), or an empty string if
+// unknown. Local image IDs without repository, like sha256:..., are not digests of the registry and are disregarded
+func (p Pod) RunningImageDigest(containerName string) string {
+	statuses := append(append(append([]k8sCoreV1.ContainerStatus{}, p.Delegate.Status.InitContainerStatuses...),
+		p.Delegate.Status.ContainerStatuses...), p.Delegate.Status.EphemeralContainerStatuses...)
+	for _, status := range statuses {
+		if status.Name == containerName {
+			if i := strings.LastIndex(status.ImageID, "@"); i >= 0 {
+				return status.ImageID[i+1:]
+			}
+			return ""
+		}
+	}
+	return ""
+}
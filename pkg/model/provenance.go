@@ -0,0 +1,52 @@
+package model
+
+// The labels set by the OpenShift builds on the built images, and the OCI ones set by other build tools
+const (
+	BuildCommitIdLabel       = "io.openshift.build.commit.id"
+	BuildSourceLocationLabel = "io.openshift.build.source-location"
+	BuildNameLabel           = "io.openshift.build.name"
+	BuildNamespaceLabel      = "io.openshift.build.namespace"
+	OCIRevisionLabel         = "org.opencontainers.image.revision"
+	OCISourceLabel           = "org.opencontainers.image.source"
+)
+
+// BuildProvenance is the source of an image, as declared by its labels
+type BuildProvenance struct {
+	SourceLocation string
+	CommitId       string
+	// Build is only known for the images built in OpenShift
+	Build BuildReference
+}
+
+// BuildReference identifies the OpenShift Build of an image
+type BuildReference struct {
+	Namespace string
+	Name      string
+}
+
+// Build is the source of an OpenShift Build, and the digest of the image it pushed, if known
+type Build struct {
+	SourceLocation string
+	CommitId       string
+	ImageDigest    string
+}
+
+// ImageProvenance returns the provenance of the given image, from the labels of the OpenShift builds or else from the
+// OCI labels. The namespace of the Build defaults to the given one
+func ImageProvenance(image ApplicationImage, namespace string) BuildProvenance {
+	labels := image.ImageLabels()
+	provenance := BuildProvenance{SourceLocation: labels[BuildSourceLocationLabel], CommitId: labels[BuildCommitIdLabel]}
+	if provenance.SourceLocation == "" {
+		provenance.SourceLocation = labels[OCISourceLabel]
+	}
+	if provenance.CommitId == "" {
+		provenance.CommitId = labels[OCIRevisionLabel]
+	}
+	if name, ok := labels[BuildNameLabel]; ok {
+		provenance.Build = BuildReference{Namespace: labels[BuildNamespaceLabel], Name: name}
+		if provenance.Build.Namespace == "" {
+			provenance.Build.Namespace = namespace
+		}
+	}
+	return provenance
+}
@@ -0,0 +1,24 @@
+package model
+
+import "testing"
+
+func TestImageProvenance(t *testing.T) {
+	built := imageByStream("image-registry.openshift-image-registry.svc:5000/app/web@"+testDigest,
+		`{"Config":{"Labels":{"io.openshift.build.commit.id":"4f2c1d0","io.openshift.build.source-location":"https://github.com/team/web.git","io.openshift.build.name":"web-7"}}}`)
+	ociLabeled := imageByStream("quay.io/team/web@"+testDigest,
+		`{"Config":{"Labels":{"org.opencontainers.image.revision":"9e8d7c6","org.opencontainers.image.source":"https://github.com/team/web","io.openshift.build.namespace":"ci"}}}`)
+
+	tests := []struct {
+		image      ApplicationImage
+		provenance BuildProvenance
+	}{
+		{built, BuildProvenance{SourceLocation: "https://github.com/team/web.git", CommitId: "4f2c1d0", Build: BuildReference{Namespace: "app", Name: "web-7"}}},
+		{ociLabeled, BuildProvenance{SourceLocation: "https://github.com/team/web", CommitId: "9e8d7c6"}},
+		{NewImageByRegistry("quay.io/team/web:1.0"), BuildProvenance{}},
+	}
+	for i, test := range tests {
+		if provenance := ImageProvenance(test.image, "app"); provenance != test.provenance {
+			t.Errorf("Test %d: expected %+v, got %+v", i, test.provenance, provenance)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"fmt"
+
+	k8sAppsV1 "k8s.io/api/apps/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+)
+
+type ReplicaSet struct {
+	Delegate k8sAppsV1.ReplicaSet
+}
+
+func (r ReplicaSet) Kind() string {
+	return "ReplicaSet"
+}
+func (r ReplicaSet) Id() string {
+	return fmt.Sprintf("replicaset %s", r.Delegate.Name)
+}
+func (r ReplicaSet) Name() string {
+	return r.Delegate.Name
+}
+func (r ReplicaSet) Label() string {
+	return r.Delegate.Name
+}
+func (r ReplicaSet) UID() k8sTypes.UID {
+	return r.Delegate.UID
+}
+
+func (r ReplicaSet) OwnerReferences() []k8sMetaV1.OwnerReference {
+	return r.Delegate.OwnerReferences
+}
+func (r ReplicaSet) IsOwnerOf(owner k8sMetaV1.OwnerReference) bool {
+	return owner.UID == r.UID()
+}
+
+func (r ReplicaSet) ApplicationConfigs() []ApplicationConfig {
+	return applicationConfigsOf(r.Delegate.Spec.Template)
+}
+func (r ReplicaSet) IsOrphanProvider() bool {
+	return len(r.OwnerReferences()) == 0
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"fmt"
+
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+)
+
+type ReplicationController struct {
+	Delegate k8sCoreV1.ReplicationController
+}
+
+func (r ReplicationController) Kind() string {
+	return "ReplicationController"
+}
+func (r ReplicationController) Id() string {
+	return fmt.Sprintf("replicationcontroller %s", r.Delegate.Name)
+}
+func (r ReplicationController) Name() string {
+	return r.Delegate.Name
+}
+func (r ReplicationController) Label() string {
+	return r.Delegate.Name
+}
+func (r ReplicationController) UID() k8sTypes.UID {
+	return r.Delegate.UID
+}
+
+func (r ReplicationController) OwnerReferences() []k8sMetaV1.OwnerReference {
+	return r.Delegate.OwnerReferences
+}
+func (r ReplicationController) IsOwnerOf(owner k8sMetaV1.OwnerReference) bool {
+	return owner.UID == r.UID()
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
 )
 
 type Resource interface {
@@ -9,6 +10,7 @@ type Resource interface {
 	Id() string
 	Name() string
 	Label() string
+	UID() k8sTypes.UID
 
 	OwnerReferences() []k8sMetaV1.OwnerReference
 	IsOwnerOf(owner k8sMetaV1.OwnerReference) bool
@@ -17,3 +19,29 @@ type Resource interface {
 type ApplicationProvider interface {
 	ApplicationConfigs() []ApplicationConfig
 }
+
+// OrphanProvider is implemented by the ApplicationProviders that are usually created by other workloads, like Jobs,
+// ReplicaSets and Pods, and are reported only when no other ApplicationProvider owns them. They are orphans when they
+// have no owner at all, unlike those owned by other resources, like the custom resources of an operator
+type OrphanProvider interface {
+	ApplicationProvider
+	IsOrphanProvider() bool
+}
+
+func IsOrphanProvider(applicationProvider ApplicationProvider) bool {
+	orphanProvider, ok := applicationProvider.(OrphanProvider)
+	return ok && orphanProvider.IsOrphanProvider()
+}
+
+// PodsOwnerProvider is implemented by the resources whose pods are owned by another resource, like the latest ready
+// Revision of a Knative Service
+type PodsOwnerProvider interface {
+	PodsOwner() Resource
+}
+
+// ControllerReference returns the reference to the owner of the given kind, name and UID, as set by its controller on
+// the resources it creates
+func ControllerReference(kind string, name string, uid k8sTypes.UID) k8sMetaV1.OwnerReference {
+	controller := true
+	return k8sMetaV1.OwnerReference{Kind: kind, Name: name, UID: uid, Controller: &controller}
+}
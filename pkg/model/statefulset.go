@@ -2,10 +2,10 @@ package model
 
 import (
 	"fmt"
-	"strings"
 
 	k8sCoreV1 "k8s.io/api/apps/v1"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
 )
 
 type StatefulSet struct {
@@ -24,17 +24,16 @@ func (s StatefulSet) Name() string {
 func (s StatefulSet) Label() string {
 	return s.Delegate.Name
 }
+func (s StatefulSet) UID() k8sTypes.UID {
+	return s.Delegate.UID
+}
 func (s StatefulSet) OwnerReferences() []k8sMetaV1.OwnerReference {
 	return s.Delegate.OwnerReferences
 }
 func (s StatefulSet) IsOwnerOf(owner k8sMetaV1.OwnerReference) bool {
-	return strings.Compare(owner.Kind, s.Kind()) == 0 && strings.Compare(owner.Name, s.Name()) == 0
+	return owner.UID == s.UID()
 }
 
 func (s StatefulSet) ApplicationConfigs() []ApplicationConfig {
-	var apps []ApplicationConfig
-	for _, c := range s.Delegate.Spec.Template.Spec.Containers {
-		apps = append(apps, ApplicationConfig{ContainerName: c.Name, ImageName: c.Image, Resources: c.Resources})
-	}
-	return apps
+	return withImageTriggers(applicationConfigsOf(s.Delegate.Spec.Template), annotationImageTriggers(s.Delegate.ObjectMeta))
 }
@@ -2,43 +2,83 @@ package model
 
 import "sync"
 
+// TopologyModel is safe for concurrent use: namespaces and images can be added by concurrent goroutines while other
+// goroutines read the model. Each NamespaceModel instead must be populated by a single goroutine, and then published
+// with AddNamespaceModel so that the readers never see a namespace being populated.
+// Namespaces are identified by cluster and name, so that the namespaces of many clusters can be collected in the same
+// model
 type TopologyModel struct {
-	namespacesByName map[string]*NamespaceModel
+	mutex            sync.RWMutex
+	namespacesByName map[clusterNamespace]*NamespaceModel
 	imageByName      map[string]ApplicationImage
 }
 
+type clusterNamespace struct {
+	cluster string
+	name    string
+}
+
 func NewTopologyModel() *TopologyModel {
 	var topology TopologyModel
-	topology.namespacesByName = make(map[string]*NamespaceModel)
+	topology.namespacesByName = make(map[clusterNamespace]*NamespaceModel)
 	topology.imageByName = make(map[string]ApplicationImage)
 	return &topology
 }
 
-var mutex = sync.RWMutex{}
+func (topology *TopologyModel) AddNamespace(name string) *NamespaceModel {
+	return topology.AddClusterNamespace("", name)
+}
+func (topology *TopologyModel) AddClusterNamespace(cluster string, name string) *NamespaceModel {
+	topology.mutex.Lock()
+	defer topology.mutex.Unlock()
+	namespace := NewNamespaceModel(cluster, name)
+	topology.namespacesByName[clusterNamespace{cluster: cluster, name: name}] = namespace
+	return namespace
+}
+
+// AddNamespaceModel publishes the given namespace, once populated, replacing any namespace with the same cluster and
+// name
+func (topology *TopologyModel) AddNamespaceModel(namespace *NamespaceModel) {
+	topology.mutex.Lock()
+	defer topology.mutex.Unlock()
+	topology.namespacesByName[clusterNamespace{cluster: namespace.cluster, name: namespace.name}] = namespace
+}
 
-func (topology TopologyModel) AddNamespace(name string) *NamespaceModel {
-	mutex.Lock()
-	namespace := NamespaceModel{name: name, resourcesByKind: make(map[string][]Resource)}
-	topology.namespacesByName[name] = &namespace
-	mutex.Unlock()
-	return &namespace
+// RemoveCluster removes all the namespaces of the given cluster, e.g. when its collection failed
+func (topology *TopologyModel) RemoveCluster(cluster string) {
+	topology.mutex.Lock()
+	defer topology.mutex.Unlock()
+	for key := range topology.namespacesByName {
+		if key.cluster == cluster {
+			delete(topology.namespacesByName, key)
+		}
+	}
+}
+func (topology *TopologyModel) NamespaceByName(name string) *NamespaceModel {
+	return topology.ClusterNamespaceByName("", name)
 }
-func (topology TopologyModel) NamespaceByName(name string) *NamespaceModel {
-	return topology.namespacesByName[name]
+func (topology *TopologyModel) ClusterNamespaceByName(cluster string, name string) *NamespaceModel {
+	topology.mutex.RLock()
+	defer topology.mutex.RUnlock()
+	return topology.namespacesByName[clusterNamespace{cluster: cluster, name: name}]
 }
-func (topology TopologyModel) AllNamespaces() []NamespaceModel {
+func (topology *TopologyModel) AllNamespaces() []NamespaceModel {
+	topology.mutex.RLock()
+	defer topology.mutex.RUnlock()
 	namespaces := make([]NamespaceModel, 0, len(topology.namespacesByName))
 	for _, namespace := range topology.namespacesByName {
 		namespaces = append(namespaces, *namespace)
 	}
 	return namespaces
 }
-func (topology TopologyModel) AddImage(imageName string, image ApplicationImage) {
-	mutex.Lock()
+func (topology *TopologyModel) AddImage(imageName string, image ApplicationImage) {
+	topology.mutex.Lock()
+	defer topology.mutex.Unlock()
 	topology.imageByName[imageName] = image
-	mutex.Unlock()
 }
-func (topology TopologyModel) ImageByName(imageName string) (ApplicationImage, bool) {
+func (topology *TopologyModel) ImageByName(imageName string) (ApplicationImage, bool) {
+	topology.mutex.RLock()
+	defer topology.mutex.RUnlock()
 	image, ok := topology.imageByName[imageName]
 	return image, ok
 }
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+)
+
+// UnstructuredResource is a Resource collected with the dynamic client, like custom resources
+type UnstructuredResource struct {
+	Delegate unstructured.Unstructured
+}
+
+func (u UnstructuredResource) Kind() string {
+	return u.Delegate.GetKind()
+}
+func (u UnstructuredResource) Id() string {
+	return fmt.Sprintf("%s %s", strings.ToLower(u.Delegate.GetKind()), u.Delegate.GetName())
+}
+func (u UnstructuredResource) Name() string {
+	return u.Delegate.GetName()
+}
+func (u UnstructuredResource) Label() string {
+	return u.Delegate.GetName()
+}
+func (u UnstructuredResource) UID() k8sTypes.UID {
+	return u.Delegate.GetUID()
+}
+
+func (u UnstructuredResource) OwnerReferences() []k8sMetaV1.OwnerReference {
+	return u.Delegate.GetOwnerReferences()
+}
+func (u UnstructuredResource) IsOwnerOf(owner k8sMetaV1.OwnerReference) bool {
+	return owner.UID == u.UID()
+}
+
+// nestedPodSpec converts the field at the given path into a PodSpec, ignoring the unknown fields
+func (u UnstructuredResource) nestedPodSpec(fields ...string) (k8sCoreV1.PodSpec, bool) {
+	var podSpec k8sCoreV1.PodSpec
+	spec, found, err := unstructured.NestedMap(u.Delegate.Object, fields...)
+	if err != nil || !found {
+		logger.Debugf("No pod spec at %s in %s %s: %v", strings.Join(fields, "."), u.Kind(), u.Name(), err)
+		return podSpec, false
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &podSpec); err != nil {
+		logger.Warnf("Cannot convert pod spec at %s in %s %s: %s", strings.Join(fields, "."), u.Kind(), u.Name(), err)
+		return podSpec, false
+	}
+	return podSpec, true
+}
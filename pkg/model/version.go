@@ -0,0 +1,78 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/dmartinol/application-exporter/pkg/config"
+)
+
+// FallbackVersion is the source of the fallback version, when no strategy finds a version. The sources of the other
+// versions are the config strategies, like config.TagVersionStrategy
+const FallbackVersion = "fallback"
+
+// OCIVersionLabel is the image label defined by the OCI image spec for the version of the packaged software
+const OCIVersionLabel = "org.opencontainers.image.version"
+
+// DefaultVersionExtractor tries the default strategies of the configuration
+var DefaultVersionExtractor = VersionExtractor{
+	Strategies: strings.Split(config.DefaultVersionStrategies, ","),
+	EnvVars:    strings.Split(config.DefaultVersionEnvVars, ","),
+	Fallback:   config.DefaultVersionFallback,
+}
+
+// VersionExtractor extracts the version of an image with the first of the ordered strategies that finds one
+type VersionExtractor struct {
+	Strategies []string
+	// TagRegexp, if set, must match the tag, and the version is its first group, if any, or the whole match
+	TagRegexp *regexp.Regexp
+	EnvVars   []string
+	Fallback  string
+}
+
+// ImageVersion returns the version of the given image, run by the given container, and the strategy which found it
+func (e VersionExtractor) ImageVersion(image ApplicationImage, applicationConfig ApplicationConfig) (string, string) {
+	for _, strategy := range e.Strategies {
+		if version := e.versionBy(strategy, image, applicationConfig); version != "" {
+			return version, strategy
+		}
+	}
+	return e.Fallback, FallbackVersion
+}
+
+func (e VersionExtractor) versionBy(strategy string, image ApplicationImage, applicationConfig ApplicationConfig) string {
+	switch strategy {
+	case config.TagVersionStrategy:
+		tag := image.ImageTag()
+		if tag == "" || e.TagRegexp == nil {
+			return tag
+		}
+		if match := e.TagRegexp.FindStringSubmatch(tag); len(match) > 1 {
+			return match[1]
+		} else if len(match) == 1 {
+			return match[0]
+		}
+	case config.OCILabelVersionStrategy:
+		return image.ImageLabels()[OCIVersionLabel]
+	case config.LabelVersionStrategy:
+		version := image.ImageLabels()["version"]
+		if release := image.ImageLabels()["release"]; version != "" && release != "" {
+			return version + "-" + release
+		}
+		return version
+	case config.EnvVersionStrategy:
+		for _, name := range e.EnvVars {
+			for _, env := range applicationConfig.Env {
+				if env.Name == name && env.Value != "" {
+					return env.Value
+				}
+			}
+			for _, env := range image.ImageEnv() {
+				if value := strings.TrimPrefix(env, name+"="); value != env && value != "" {
+					return value
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/dmartinol/application-exporter/pkg/config"
+	imageV1 "github.com/openshift/api/image/v1"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func imageByStream(reference string, metadata string) *ImageByStream {
+	return NewImageByStream(reference, imageV1.Image{DockerImageReference: reference, DockerImageMetadata: runtime.RawExtension{Raw: []byte(metadata)}})
+}
+
+func TestVersionExtractor(t *testing.T) {
+	labeled := imageByStream("quay.io/x/app@"+testDigest,
+		`{"Config":{"Labels":{"org.opencontainers.image.version":"2.4.0","version":"7.9.1","release":"3"},"Env":["PATH=/bin","JBOSS_IMAGE_VERSION=7.9.1"]}}`)
+	tagged := NewImageByRegistry("quay.io/x/app:v1.2.3-ubi8")
+	latest := imageByStream("quay.io/x/app:latest", `{"Config":{"Labels":{"version":"7.9.1"}}}`)
+	withEnv := ApplicationConfig{Env: []k8sCoreV1.EnvVar{{Name: "APP_VERSION", Value: "1.5"}}}
+
+	tests := []struct {
+		extractor VersionExtractor
+		image     ApplicationImage
+		config    ApplicationConfig
+		version   string
+		source    string
+	}{
+		{DefaultVersionExtractor, tagged, ApplicationConfig{}, "v1.2.3-ubi8", config.TagVersionStrategy},
+		{DefaultVersionExtractor, labeled, ApplicationConfig{}, "2.4.0", config.OCILabelVersionStrategy},
+		{DefaultVersionExtractor, latest, ApplicationConfig{}, "7.9.1", config.LabelVersionStrategy},
+		{VersionExtractor{Strategies: []string{config.LabelVersionStrategy}}, labeled, ApplicationConfig{}, "7.9.1-3", config.LabelVersionStrategy},
+		{VersionExtractor{Strategies: []string{config.TagVersionStrategy}, TagRegexp: regexp.MustCompile(`^v?([0-9.]+)`)}, tagged, ApplicationConfig{}, "1.2.3", config.TagVersionStrategy},
+		{VersionExtractor{Strategies: []string{config.TagVersionStrategy}, TagRegexp: regexp.MustCompile(`^[0-9.]+$`), Fallback: "unknown"}, tagged, ApplicationConfig{}, "unknown", FallbackVersion},
+		{VersionExtractor{Strategies: []string{config.EnvVersionStrategy}, EnvVars: []string{"JBOSS_IMAGE_VERSION"}}, labeled, ApplicationConfig{}, "7.9.1", config.EnvVersionStrategy},
+		{VersionExtractor{Strategies: []string{config.EnvVersionStrategy, config.TagVersionStrategy}, EnvVars: []string{"APP_VERSION"}}, tagged, withEnv, "1.5", config.EnvVersionStrategy},
+		{VersionExtractor{Strategies: []string{config.OCILabelVersionStrategy, config.EnvVersionStrategy}, EnvVars: []string{"APP_VERSION"}, Fallback: "NA"}, tagged, ApplicationConfig{}, "NA", FallbackVersion},
+	}
+	for i, test := range tests {
+		version, source := test.extractor.ImageVersion(test.image, test.config)
+		if version != test.version || source != test.source {
+			t.Errorf("Test %d: expected version %s from %s, got %s from %s", i, test.version, test.source, version, source)
+		}
+	}
+}
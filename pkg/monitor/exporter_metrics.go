@@ -1,12 +1,15 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dmartinol/application-exporter/pkg/config"
 	cfg "github.com/dmartinol/application-exporter/pkg/config"
@@ -33,6 +36,8 @@ type ExporterMetrics struct {
 	appVersion         *prometheus.GaugeVec
 	appResourcesConfig *prometheus.GaugeVec
 	appResourcesUsage  *prometheus.GaugeVec
+	appImageAge        *prometheus.GaugeVec
+	appImageSize       *prometheus.GaugeVec
 }
 
 var router = mux.NewRouter()
@@ -47,23 +52,29 @@ func NewExporterMetrics(config *cfg.Config) *ExporterMetrics {
 	exporterMetrics.appVersion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "application_version",
 		Help: `.`,
-	}, []string{"environment", "namespace", "application", "type", "container", "image", "version", "full_image"})
+	}, []string{"environment", "cluster", "namespace", "application", "type", "orphan", "owner", "container", "role", "image", "version", "version_source", "full_image", "registry", "repository", "tag", "image_digest", "running_image_digest", "drift", "image_stream", "image_stream_tag", "behind", "source_location", "commit", "build", "build_verified", "image_created", "stale", "mutable_tag"})
+	exporterMetrics.appImageAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "application_image_age_seconds",
+		Help: `Age of the image of the container, since its creation.`,
+	}, []string{"environment", "cluster", "namespace", "application", "type", "orphan", "container", "role", "image", "full_image", "stale"})
+	exporterMetrics.appImageSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "application_image_size_bytes",
+		Help: `Compressed size of the image of the container.`,
+	}, []string{"environment", "cluster", "namespace", "application", "type", "orphan", "container", "role", "image", "full_image"})
 	exporterMetrics.appResourcesConfig = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "application_resources_config",
 		Help: `.`,
-	}, []string{"environment", "namespace", "application", "type", "container", "cpu_limits", "memory_limits", "cpu_requests", "memory_requests"})
+	}, []string{"environment", "cluster", "namespace", "application", "type", "orphan", "container", "role", "cpu_limits", "memory_limits", "cpu_requests", "memory_requests"})
 	exporterMetrics.appResourcesUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "application_resources_usage",
 		Help: `.`,
-	}, []string{"environment", "namespace", "application", "type", "pod", "container", "cpu_usage", "memory_usage"})
-
-	prometheus.Register(&exporterMetrics)
+	}, []string{"environment", "cluster", "namespace", "application", "type", "orphan", "pod", "container", "role", "cpu_usage", "memory_usage"})
 
 	return &exporterMetrics
 }
 
 func (s *ExporterMetrics) Start() {
-	router.Path("/metrics").Handler(promhttp.Handler())
+	router.Path("/metrics").HandlerFunc(s.metricsHandler)
 
 	host := "localhost"
 	if s.config.RunInContainer() {
@@ -76,40 +87,84 @@ func (s *ExporterMetrics) Start() {
 	}
 }
 
+// metricsHandler binds the collection to the context of the scrape request, so that the collection is interrupted
+// when Prometheus gives up on the scrape
+func (em *ExporterMetrics) metricsHandler(rw http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if v := req.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(seconds*float64(time.Second)))
+			defer cancel()
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&scrapeCollector{exporterMetrics: em, ctx: ctx})
+	promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, registry}, promhttp.HandlerOpts{}).ServeHTTP(rw, req)
+}
+
+// scrapeCollector runs a single scrape of the ExporterMetrics within the given context
+type scrapeCollector struct {
+	exporterMetrics *ExporterMetrics
+	ctx             context.Context
+}
+
 // Collect implements prometheus.Collector
-func (em *ExporterMetrics) Collect(ch chan<- prometheus.Metric) {
+func (c *scrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.exporterMetrics.Collect(c.ctx, ch)
+}
+
+// Describe implements prometheus.Collector
+func (c *scrapeCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.exporterMetrics.Describe(ch)
+}
+
+func (em *ExporterMetrics) Collect(ctx context.Context, ch chan<- prometheus.Metric) {
 	logger.Infof("Collect invoked")
 
 	// Creates a REST service exporter but does not start it
 	exporterService := exporter.NewExporterService(em.config)
 	runner := exporterService.NewRunner(em.config, nil, nil)
 
-	kubeConfig, err := runner.Connect()
-	if err != nil {
-		logger.Fatalf("Cannot connect cluster: %s", err)
-		// TBD
-		// return err
-	}
-
-	logger.Info("Cluster connected")
 	for _, r := range em.runnerConfigs {
-		topology, err := runner.Collect(r, kubeConfig)
+		// The clusters which fail are skipped, so that the metrics of the other clusters of the environment are exported
+		clusters, err := runner.Connect(r)
+		if len(clusters) == 0 {
+			logger.Warnf("Cannot connect clusters for environment %s: %s", r.Environment(), err)
+			continue
+		}
 		if err != nil {
-			logger.Fatalf("Cannot collect metrics from cluster: %s", err)
-			// TBD
-			// return err
+			logger.Warnf("Skipping the clusters which cannot be connected for environment %s: %s", r.Environment(), err)
+		}
+		topology, err := runner.Collect(ctx, r, clusters)
+		if topology == nil {
+			logger.Warnf("Cannot collect metrics from cluster for environment %s: %s", r.Environment(), err)
+			continue
+		}
+		if err != nil {
+			logger.Warnf("Skipping the clusters which cannot be collected for environment %s: %s", r.Environment(), err)
 		}
 
+		mutableTagSet := formatter.MutableTagSet(formatter.MutableTags(em.config, topology))
 		for _, namespace := range formatter.SortedNamespaces(topology) {
 			for _, applicationProvider := range namespace.AllApplicationProviders() {
 				logger.Debugf("## %s %s", applicationProvider.(model.Resource).Kind(), applicationProvider.(model.Resource).Name())
-				for _, applicationConfig := range applicationProvider.ApplicationConfigs() {
-					g := em.applicationVersionMetric(r, topology, namespace.Name(), applicationProvider.(model.Resource), applicationConfig)
+				for _, applicationConfig := range formatter.ApplicationConfigs(em.config, namespace, applicationProvider) {
+					g := em.applicationVersionMetric(r, topology, mutableTagSet, namespace, applicationProvider.(model.Resource), applicationConfig)
 					logger.Debugf("Adding to ch: %s", g.Desc())
 					ch <- g
+					if g := em.imageAgeMetric(r, topology, namespace, applicationProvider.(model.Resource), applicationConfig); g != nil {
+						logger.Debugf("Adding to ch: %s", g.Desc())
+						ch <- g
+					}
+					if g := em.imageSizeMetric(r, topology, namespace, applicationProvider.(model.Resource), applicationConfig); g != nil {
+						logger.Debugf("Adding to ch: %s", g.Desc())
+						ch <- g
+					}
 
 					if em.config.WithResources() {
-						g = em.resourcesConfigMetric(r, namespace.Name(), applicationProvider.(model.Resource), applicationConfig)
+						g = em.resourcesConfigMetric(r, namespace, applicationProvider.(model.Resource), applicationConfig)
 						logger.Debugf("Adding to ch: %s", g.Desc())
 						ch <- g
 
@@ -124,20 +179,33 @@ func (em *ExporterMetrics) Collect(ch chan<- prometheus.Metric) {
 	}
 }
 
-// Describe implements prometheus.Collector
 func (m *ExporterMetrics) Describe(ch chan<- *prometheus.Desc) {
-	ch <- m.appVersion.WithLabelValues("", "", "", "", "", "", "", "").Desc()
+	m.appVersion.Describe(ch)
+	m.appResourcesConfig.Describe(ch)
+	m.appResourcesUsage.Describe(ch)
+	m.appImageAge.Describe(ch)
+	m.appImageSize.Describe(ch)
 }
 
-func (em *ExporterMetrics) applicationVersionMetric(runnerConfig *cfg.RunnerConfig, topology *model.TopologyModel, namespace string, application model.Resource, applicationConfig model.ApplicationConfig) prometheus.Gauge {
+func (em *ExporterMetrics) applicationVersionMetric(runnerConfig *cfg.RunnerConfig, topology *model.TopologyModel, mutableTagSet map[string]bool, namespace model.NamespaceModel, application model.Resource, applicationConfig model.ApplicationConfig) prometheus.Gauge {
 	var record []string
-	record = append(record, runnerConfig.Environment(), namespace, application.Name(), application.Kind(), applicationConfig.ContainerName)
+	record = append(record, runnerConfig.Environment(), namespace.Cluster(), namespace.Name(), application.Name(), application.Kind(), orphanLabel(application), formatter.Owner(namespace, application), applicationConfig.ContainerName, applicationConfig.Role.String())
+	version, versionSource := formatter.ImageVersion(em.config, topology, applicationConfig)
 	applicationImage, ok := topology.ImageByName(applicationConfig.ImageName)
 	if ok {
-		record = append(record, applicationImage.ImageName(), applicationImage.ImageVersion(), applicationImage.ImageFullName())
+		record = append(record, applicationImage.ImageName(), version, versionSource, applicationImage.ImageFullName())
 	} else {
-		record = append(record, applicationConfig.ImageName, "NA", applicationConfig.ImageName)
+		record = append(record, applicationConfig.ImageName, version, versionSource, applicationConfig.ImageName)
 	}
+	registry, repository, tag := formatter.ImageReference(applicationConfig)
+	runningDigest, drift := formatter.RunningImageDigest(namespace, application, applicationConfig)
+	record = append(record, registry, repository, tag, formatter.ImageDigest(applicationConfig), runningDigest, strconv.FormatBool(drift))
+	stream, streamTag, behind := formatter.ImageStreamTag(namespace, application, applicationConfig)
+	record = append(record, stream, streamTag, behind)
+	sourceLocation, commit, build, verified := formatter.BuildProvenance(topology, namespace, applicationConfig)
+	record = append(record, sourceLocation, commit, build, verified)
+	created, _, stale := formatter.ImageAge(em.config, topology, applicationConfig, time.Now())
+	record = append(record, created, stale, formatter.IsMutableTag(mutableTagSet, applicationConfig))
 
 	g := em.appVersion.WithLabelValues(record...)
 	// TBD
@@ -145,10 +213,46 @@ func (em *ExporterMetrics) applicationVersionMetric(runnerConfig *cfg.RunnerConf
 	return g
 }
 
-func (em *ExporterMetrics) resourcesConfigMetric(runnerConfig *cfg.RunnerConfig, namespace string, application model.Resource, applicationConfig model.ApplicationConfig) prometheus.Gauge {
+// imageAgeMetric returns the age of the image of the given container in seconds, or nil if its creation time is unknown
+func (em *ExporterMetrics) imageAgeMetric(runnerConfig *cfg.RunnerConfig, topology *model.TopologyModel, namespace model.NamespaceModel, application model.Resource, applicationConfig model.ApplicationConfig) prometheus.Gauge {
+	now := time.Now()
+	created := formatter.ImageCreated(topology, applicationConfig)
+	if created.IsZero() {
+		return nil
+	}
+	_, _, stale := formatter.ImageAge(em.config, topology, applicationConfig, now)
+	record := append(imageLabels(runnerConfig, topology, namespace, application, applicationConfig), stale)
+	g := em.appImageAge.WithLabelValues(record...)
+	g.Set(now.Sub(created).Seconds())
+	return g
+}
+
+// imageSizeMetric returns the compressed size of the image of the given container, or nil if unknown
+func (em *ExporterMetrics) imageSizeMetric(runnerConfig *cfg.RunnerConfig, topology *model.TopologyModel, namespace model.NamespaceModel, application model.Resource, applicationConfig model.ApplicationConfig) prometheus.Gauge {
+	applicationImage, ok := topology.ImageByName(applicationConfig.ImageName)
+	if !ok || applicationImage.ImageSize() == 0 {
+		return nil
+	}
+	g := em.appImageSize.WithLabelValues(imageLabels(runnerConfig, topology, namespace, application, applicationConfig)...)
+	g.Set(float64(applicationImage.ImageSize()))
+	return g
+}
+
+// imageLabels returns the labels of the image metrics of the given container
+func imageLabels(runnerConfig *cfg.RunnerConfig, topology *model.TopologyModel, namespace model.NamespaceModel, application model.Resource, applicationConfig model.ApplicationConfig) []string {
+	var record []string
+	record = append(record, runnerConfig.Environment(), namespace.Cluster(), namespace.Name(), application.Name(), application.Kind(), orphanLabel(application), applicationConfig.ContainerName, applicationConfig.Role.String())
+	imageName := applicationConfig.ImageName
+	if applicationImage, ok := topology.ImageByName(applicationConfig.ImageName); ok {
+		imageName = applicationImage.ImageName()
+	}
+	return append(record, imageName, applicationConfig.ImageName)
+}
+
+func (em *ExporterMetrics) resourcesConfigMetric(runnerConfig *cfg.RunnerConfig, namespace model.NamespaceModel, application model.Resource, applicationConfig model.ApplicationConfig) prometheus.Gauge {
 	var record []string
 	res := applicationConfig.Resources
-	record = append(record, runnerConfig.Environment(), namespace, application.Name(), application.Kind(), applicationConfig.ContainerName)
+	record = append(record, runnerConfig.Environment(), namespace.Cluster(), namespace.Name(), application.Name(), application.Kind(), orphanLabel(application), applicationConfig.ContainerName, applicationConfig.Role.String())
 	record = append(record, formatter.CpuLimits(res), formatter.MemoryLimits(res), formatter.CpuRequests(res), formatter.MemoryRequests(res))
 	g := em.appResourcesConfig.WithLabelValues(record...)
 	// TBD
@@ -162,7 +266,7 @@ func (em *ExporterMetrics) resourcesUsageMetric(runnerConfig *cfg.RunnerConfig,
 	for _, pod := range namespace.AllPodsOf(application) {
 		if pod.IsRunning() {
 			var record []string
-			record = append(record, runnerConfig.Environment(), namespace.Name(), application.Name(), application.Kind(), pod.Name(), applicationConfig.ContainerName)
+			record = append(record, runnerConfig.Environment(), namespace.Cluster(), namespace.Name(), application.Name(), application.Kind(), orphanLabel(application), pod.Name(), applicationConfig.ContainerName, applicationConfig.Role.String())
 			usage := pod.UsageForContainer(applicationConfig.ContainerName)
 			if usage != nil {
 				record = append(record, formatter.CpuUsage(usage), formatter.MemoryUsage(usage))
@@ -185,6 +289,11 @@ func (em *ExporterMetrics) resourcesUsageMetric(runnerConfig *cfg.RunnerConfig,
 	return metrics
 }
 
+func orphanLabel(application model.Resource) string {
+	applicationProvider, ok := application.(model.ApplicationProvider)
+	return strconv.FormatBool(ok && model.IsOrphanProvider(applicationProvider))
+}
+
 func (em *ExporterMetrics) initRunnerConfigs() {
 	configFolder := "/etc/exporter"
 	if v, ok := os.LookupEnv("CONFIG_FOLDER"); ok {
@@ -207,6 +316,9 @@ func (em *ExporterMetrics) initRunnerConfigs() {
 			p := properties.MustLoadFile(fileName, properties.UTF8)
 
 			runnerConfig := cfg.NewRunnerConfigFromProperties(p)
+			if err := runnerConfig.ValidateKinds(em.config.CustomKinds()); err != nil {
+				logger.Fatalf("Cannot parse kinds property of %s: %s", fileName, err)
+			}
 			logger.Infof("Added runner config: %s", runnerConfig)
 			em.runnerConfigs = append(em.runnerConfigs, runnerConfig)
 		}
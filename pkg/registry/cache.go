@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	"github.com/dmartinol/application-exporter/pkg/model"
+)
+
+// Cache stores the image configurations by digest, in memory and optionally as files of the given directory, since
+// the content of a digest never changes
+type Cache struct {
+	mutex   sync.RWMutex
+	dir     string
+	configs map[string]*model.ImageConfig
+}
+
+// NewCache returns a Cache storing the configurations in the given directory, or only in memory if empty
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir, configs: make(map[string]*model.ImageConfig)}
+}
+
+func (c *Cache) Get(digest string) (*model.ImageConfig, bool) {
+	c.mutex.RLock()
+	config, ok := c.configs[digest]
+	c.mutex.RUnlock()
+	if ok || c.dir == "" {
+		return config, ok
+	}
+
+	data, err := os.ReadFile(c.fileName(digest))
+	if err != nil {
+		return nil, false
+	}
+	config = &model.ImageConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		logger.Warnf("Disregarding invalid cache file %s: %s", c.fileName(digest), err)
+		return nil, false
+	}
+	c.mutex.Lock()
+	c.configs[digest] = config
+	c.mutex.Unlock()
+	return config, true
+}
+
+func (c *Cache) Put(digest string, config *model.ImageConfig) {
+	c.mutex.Lock()
+	c.configs[digest] = config
+	c.mutex.Unlock()
+	if c.dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(config)
+	if err == nil {
+		err = os.MkdirAll(c.dir, 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(c.fileName(digest), data, 0o644)
+	}
+	if err != nil {
+		logger.Warnf("Cannot cache the configuration of %s: %s", digest, err)
+	}
+}
+
+// fileName returns the cache file of the given digest, like sha256-0123....json
+func (c *Cache) fileName(digest string) string {
+	return filepath.Join(c.dir, filepath.Base(strings.ReplaceAll(digest, ":", "-"))+".json")
+}
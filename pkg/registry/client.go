@@ -0,0 +1,283 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	"github.com/dmartinol/application-exporter/pkg/model"
+)
+
+// The media types of the manifests, either of a single image or of an index of images by platform
+const (
+	ociManifest        = "application/vnd.oci.image.manifest.v1+json"
+	ociIndex           = "application/vnd.oci.image.index.v1+json"
+	dockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+const (
+	// maxResponseSize limits the size of the manifests, configurations and tokens read from the registries
+	maxResponseSize     = 4 << 20
+	defaultPlatformOS   = "linux"
+	defaultPlatformArch = "amd64"
+	// dockerHubAPI is the host serving the API of the DefaultRegistry
+	dockerHubAPI = "registry-1.docker.io"
+)
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Platform  *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform,omitempty"`
+}
+
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+type configBlob struct {
+	Created time.Time `json:"created"`
+	Config  struct {
+		Labels map[string]string `json:"Labels"`
+		Env    []string          `json:"Env"`
+	} `json:"config"`
+}
+
+// Client fetches the configuration of the images from their registries, with the Docker Registry HTTP API V2 of the
+// OCI distribution spec. The configurations are cached by digest
+type Client struct {
+	httpClient  *http.Client
+	credentials Credentials
+	cache       *Cache
+
+	mutex  sync.Mutex
+	tokens map[string]string
+	// Errors by image reference and user, not retried for the lifetime of the client
+	failures map[string]error
+}
+
+// NewClient returns a Client authenticating with the given credentials, and caching the configurations in the given
+// directory, or only in memory if empty
+func NewClient(httpClient *http.Client, credentials Credentials, cacheDir string) *Client {
+	return &Client{httpClient: httpClient, credentials: credentials, cache: NewCache(cacheDir),
+		tokens: make(map[string]string), failures: make(map[string]error)}
+}
+
+// ImageConfig returns the configuration of the given image, authenticating with the given credentials, like those of
+// the pull secrets, or with the ones of the client. For multi-platform images, the linux/amd64 image is returned, or
+// the first one
+func (c *Client) ImageConfig(ctx context.Context, ref model.ImageReference, credentials Credentials) (*model.ImageConfig, error) {
+	authConfig, ok := credentials.Lookup(ref.Registry)
+	if !ok {
+		authConfig, _ = c.credentials.Lookup(ref.Registry)
+	}
+	failureKey := ref.String() + "/" + authConfig.Username
+	c.mutex.Lock()
+	err, failed := c.failures[failureKey]
+	c.mutex.Unlock()
+	if failed {
+		return nil, err
+	}
+	config, err := c.imageConfig(ctx, ref, authConfig)
+	if err != nil && ctx.Err() == nil {
+		c.mutex.Lock()
+		c.failures[failureKey] = err
+		c.mutex.Unlock()
+	}
+	return config, err
+}
+
+func (c *Client) imageConfig(ctx context.Context, ref model.ImageReference, authConfig AuthConfig) (*model.ImageConfig, error) {
+	if ref.Digest != "" {
+		if config, ok := c.cache.Get(ref.Digest); ok {
+			logger.Debugf("Found cached configuration of %s", ref)
+			return config, nil
+		}
+	}
+
+	reference := ref.Digest
+	if reference == "" {
+		reference = ref.Tag
+	}
+	if reference == "" {
+		reference = "latest"
+	}
+	imageManifest, digest, err := c.manifest(ctx, ref, authConfig, reference)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Digest == "" && digest != "" {
+		if config, ok := c.cache.Get(digest); ok {
+			return config, nil
+		}
+	}
+	if len(imageManifest.Manifests) > 0 {
+		platformDigest := imageManifest.Manifests[0].Digest
+		for _, m := range imageManifest.Manifests {
+			if m.Platform != nil && m.Platform.OS == defaultPlatformOS && m.Platform.Architecture == defaultPlatformArch {
+				platformDigest = m.Digest
+				break
+			}
+		}
+		if imageManifest, _, err = c.manifest(ctx, ref, authConfig, platformDigest); err != nil {
+			return nil, err
+		}
+	}
+	if imageManifest.Config.Digest == "" {
+		return nil, fmt.Errorf("no configuration in the manifest of %s", ref)
+	}
+
+	data, _, err := c.get(ctx, ref, authConfig, "blobs/"+imageManifest.Config.Digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	var blob configBlob
+	if err := json.Unmarshal(data, &blob); err != nil {
+		return nil, fmt.Errorf("invalid configuration of %s: %w", ref, err)
+	}
+	config := &model.ImageConfig{Created: blob.Created, Labels: blob.Config.Labels, Env: blob.Config.Env}
+	for _, layer := range imageManifest.Layers {
+		config.Layers = append(config.Layers, model.ImageLayer{Digest: layer.Digest, Size: layer.Size})
+	}
+	if ref.Digest != "" {
+		digest = ref.Digest
+	}
+	if digest != "" {
+		c.cache.Put(digest, config)
+	}
+	return config, nil
+}
+
+// manifest returns the manifest of the given tag or digest, and its digest as returned by the registry
+func (c *Client) manifest(ctx context.Context, ref model.ImageReference, authConfig AuthConfig, reference string) (*manifest, string, error) {
+	data, header, err := c.get(ctx, ref, authConfig, "manifests/"+reference, []string{ociManifest, ociIndex, dockerManifest, dockerManifestList})
+	if err != nil {
+		return nil, "", err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, "", fmt.Errorf("invalid manifest of %s: %w", ref, err)
+	}
+	return &m, header.Get("Docker-Content-Digest"), nil
+}
+
+// get requests the given path of the repository, authenticating with a bearer token when requested by the registry,
+// or with the basic authentication
+func (c *Client) get(ctx context.Context, ref model.ImageReference, authConfig AuthConfig, path string, accept []string) ([]byte, http.Header, error) {
+	host := ref.Registry
+	if host == model.DefaultRegistry {
+		host = dockerHubAPI
+	}
+	// Tokens are scoped to the repository, and to the user of the pull secret
+	tokenKey := host + "/" + ref.Repository + "/" + authConfig.Username
+	requestURL := fmt.Sprintf("https://%s/v2/%s/%s", host, ref.Repository, path)
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, mediaType := range accept {
+			req.Header.Add("Accept", mediaType)
+		}
+		c.mutex.Lock()
+		token := c.tokens[tokenKey]
+		c.mutex.Unlock()
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if authConfig.Username != "" {
+			req.SetBasicAuth(authConfig.Username, authConfig.Password)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+				return nil, nil, fmt.Errorf("unauthorized to get %s of %s", path, ref)
+			}
+			token, err := c.token(ctx, challenge, authConfig)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot authenticate to %s: %w", ref.Registry, err)
+			}
+			c.mutex.Lock()
+			c.tokens[tokenKey] = token
+			c.mutex.Unlock()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf("cannot get %s of %s: %s", path, ref, resp.Status)
+		}
+		return data, resp.Header, nil
+	}
+}
+
+// token returns a bearer token from the realm of the given challenge, like
+// Bearer realm="https://auth.example.com/token",service="registry",scope="repository:team/app:pull"
+func (c *Client) token(ctx context.Context, challenge string, authConfig AuthConfig) (string, error) {
+	params := make(map[string]string)
+	for _, param := range strings.Split(challenge[len("bearer "):], ",") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok {
+			params[strings.ToLower(key)] = strings.Trim(value, `"`)
+		}
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid realm in challenge %s", challenge)
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if authConfig.Username != "" {
+		req.SetBasicAuth(authConfig.Username, authConfig.Password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot get token: %s", resp.Status)
+	}
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&tokenResponse); err != nil {
+		return "", err
+	}
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+	return tokenResponse.AccessToken, nil
+}
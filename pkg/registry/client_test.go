@@ -0,0 +1,126 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	logger "github.com/dmartinol/application-exporter/pkg/log"
+	"github.com/dmartinol/application-exporter/pkg/model"
+)
+
+const (
+	indexDigest    = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	manifestDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	configDigest   = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+)
+
+func init() {
+	logger.InitLogger(false, "warn")
+}
+
+// newTestRegistry returns a registry stand-in serving the multi-platform image team/app:1.0, which requires a bearer
+// token obtained with the user:secret credentials, and the number of requests it served
+func newTestRegistry(t *testing.T) (*httptest.Server, *int32) {
+	var requests int32
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("scope") != "repository:team/app:pull" {
+			t.Errorf("Unexpected scope %s", r.URL.Query().Get("scope"))
+		}
+		fmt.Fprint(w, `{"token":"test-token"}`)
+	})
+	mux.HandleFunc("/v2/team/app/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:team/app:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch strings.TrimPrefix(r.URL.Path, "/v2/team/app/") {
+		case "manifests/1.0", "manifests/" + indexDigest:
+			w.Header().Set("Docker-Content-Digest", indexDigest)
+			fmt.Fprintf(w, `{"mediaType":"%s","manifests":[{"digest":"sha256:arm","platform":{"os":"linux","architecture":"arm64"}},{"digest":"%s","platform":{"os":"linux","architecture":"amd64"}}]}`, ociIndex, manifestDigest)
+		case "manifests/" + manifestDigest:
+			fmt.Fprintf(w, `{"mediaType":"%s","config":{"digest":"%s"},"layers":[{"digest":"sha256:base","size":300},{"digest":"sha256:app","size":20}]}`, ociManifest, configDigest)
+		case "blobs/" + configDigest:
+			fmt.Fprint(w, `{"created":"2022-10-01T10:00:00Z","config":{"Labels":{"org.opencontainers.image.version":"1.0.3"},"Env":["APP_VERSION=1.0.3"]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	server = httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestImageConfig(t *testing.T) {
+	server, requests := newTestRegistry(t)
+	registry := strings.TrimPrefix(server.URL, "https://")
+	ref, err := model.ParseImageReference(registry + "/team/app:1.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	cacheDir := t.TempDir()
+
+	client := NewClient(server.Client(), nil, cacheDir)
+	if _, err := client.ImageConfig(context.Background(), ref, nil); err == nil {
+		t.Errorf("Expected error without credentials")
+	}
+	credentials := Credentials{registry: {Username: "user", Password: "secret"}}
+	config, err := client.ImageConfig(context.Background(), ref, credentials)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if config.Labels[model.OCIVersionLabel] != "1.0.3" || len(config.Env) != 1 || config.Created.Year() != 2022 || len(config.Layers) != 2 {
+		t.Errorf("Unexpected configuration %+v", config)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, strings.ReplaceAll(indexDigest, ":", "-")+".json")); err != nil {
+		t.Errorf("Missing cache file: %s", err)
+	}
+
+	// The image referenced by digest is found in the cache directory by a new client, without any request
+	served := atomic.LoadInt32(requests)
+	ref, _ = model.ParseImageReference(registry + "/team/app@" + indexDigest)
+	config, err = NewClient(server.Client(), credentials, cacheDir).ImageConfig(context.Background(), ref, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if config.Labels[model.OCIVersionLabel] != "1.0.3" {
+		t.Errorf("Unexpected cached configuration %+v", config)
+	}
+	if atomic.LoadInt32(requests) != served {
+		t.Errorf("Expected no requests for a cached digest, got %d", atomic.LoadInt32(requests)-served)
+	}
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("robot:p:ss"))
+	for _, data := range []string{
+		fmt.Sprintf(`{"auths":{"https://index.docker.io/v1/":{"auth":"%s"},"quay.io":{"username":"u","password":"p"}}}`, auth),
+		fmt.Sprintf(`{"https://index.docker.io/v1/":{"auth":"%s"},"quay.io":{"username":"u","password":"p"}}`, auth),
+	} {
+		credentials, err := ParseDockerConfig([]byte(data))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if authConfig, ok := credentials.Lookup("docker.io"); !ok || authConfig.Username != "robot" || authConfig.Password != "p:ss" {
+			t.Errorf("Unexpected credentials of docker.io: %+v", authConfig)
+		}
+		if authConfig, ok := credentials.Lookup("quay.io"); !ok || authConfig.Username != "u" {
+			t.Errorf("Unexpected credentials of quay.io: %+v", authConfig)
+		}
+	}
+}
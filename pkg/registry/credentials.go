@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AuthConfig is the username and password to authenticate to a registry
+type AuthConfig struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// Credentials are the AuthConfigs by registry, as in the auths of a Docker config file
+type Credentials map[string]AuthConfig
+
+// ParseDockerConfig parses the content of a Docker config file, like ~/.docker/config.json or the .dockerconfigjson of a
+// pull secret, or of a legacy .dockercfg file, where the registries are at the top level
+func ParseDockerConfig(data []byte) (Credentials, error) {
+	var dockerConfig struct {
+		Auths Credentials `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &dockerConfig); err != nil {
+		return nil, err
+	}
+	credentials := dockerConfig.Auths
+	if credentials == nil {
+		if err := json.Unmarshal(data, &credentials); err != nil {
+			return nil, err
+		}
+	}
+
+	parsed := make(Credentials, len(credentials))
+	for registry, authConfig := range credentials {
+		if authConfig.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(authConfig.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth of %s: %w", registry, err)
+			}
+			authConfig.Username, authConfig.Password, _ = strings.Cut(string(decoded), ":")
+			authConfig.Auth = ""
+		}
+		parsed[normalizeRegistry(registry)] = authConfig
+	}
+	return parsed, nil
+}
+
+// LoadCredentials loads the credentials of the given Docker config file
+func LoadCredentials(fileName string) (Credentials, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDockerConfig(data)
+}
+
+// Merge returns the credentials of both, where the given ones take precedence
+func (c Credentials) Merge(other Credentials) Credentials {
+	merged := make(Credentials, len(c)+len(other))
+	for registry, authConfig := range c {
+		merged[registry] = authConfig
+	}
+	for registry, authConfig := range other {
+		merged[registry] = authConfig
+	}
+	return merged
+}
+
+// Lookup returns the AuthConfig of the given registry, like quay.io or registry:5000
+func (c Credentials) Lookup(registry string) (AuthConfig, bool) {
+	authConfig, ok := c[normalizeRegistry(registry)]
+	return authConfig, ok
+}
+
+// normalizeRegistry strips the scheme and the path of the registry keys, like https://index.docker.io/v1/, and maps the
+// aliases of Docker Hub to docker.io
+func normalizeRegistry(registry string) string {
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	registry, _, _ = strings.Cut(registry, "/")
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return registry
+}